@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package diff
+
+import (
+	"os"
+)
+
+// chown is a no-op on systems without Unix file ownership.
+func chown(file string, info os.FileInfo) error {
+	return nil
+}
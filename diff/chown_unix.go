@@ -0,0 +1,17 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package diff
+
+import (
+	"os"
+	"syscall"
+)
+
+// chown gives the file the same owner and group as the original file.
+func chown(file string, info os.FileInfo) error {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return os.Chown(file, int(st.Uid), int(st.Gid))
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package diff
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+)
+
+// Conflicts lists the symbols declared both in the src files and in the from
+// files whose declarations differ, ignoring comments and formatting.
+// The from files are left untouched.
+func (a *Arguments) Conflicts() ([]Conflict, error) {
+	if err := a.prepare(); err != nil {
+		return nil, err
+	}
+	errs, ok := a.loadSymbols(readSources(a.srcFiles, a.readFile), &Result{})
+	if !ok {
+		return nil, errs.err()
+	}
+	fromFiles := readSources(a.fromFiles, a.readFile)
+	var conflicts []Conflict
+	for _, from := range a.fromFiles {
+		c, err := a.conflictsInFile(fromFiles, from)
+		if err != nil {
+			errs = append(errs, err)
+			if a.Verbose {
+				fmt.Fprintf(a.Stdout, "Error parsing from file \"%s\": %v\n", from, err)
+			}
+		}
+		conflicts = append(conflicts, c...)
+	}
+	return conflicts, errs.err()
+}
+
+func (a *Arguments) conflictsInFile(from *sources, name string) (conflicts []Conflict, err error) {
+	fileName, src, err := from.file(name)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet() // positions are relative to fset
+	f, err := parser.ParseFile(fset, fileName, src, 0)
+	if err != nil {
+		return nil, err
+	}
+	ast.Walk(&visitor{func(kind SymbolKind, recv string, name *ast.Ident, decl string) {
+		key, ok := a.srcSymbol(kind, recv, name.Name, f.Name.Name)
+		if !ok || a.symbols[key] == decl {
+			return
+		}
+		conflicts = append(conflicts, Conflict{
+			Kind: kind,
+			Name: symbolKey(kind, recv, name.Name),
+			Pos:  fset.Position(name.Pos()),
+			Src:  a.symbols[key],
+			From: decl,
+		})
+	}}, f)
+	return conflicts, nil
+}
@@ -4,39 +4,190 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 )
 
 // Arguments to the diff-sub algorithm
 type Arguments struct {
-	Src  []string // the files whose function, constant and variable declarations should be considered
-	From []string // the files from where the considered declarations should be removed
+	Src  []string // the files, directories or packages whose function, constant and variable declarations should be considered
+	From []string // the files, directories or packages from where the considered declarations should be removed
+	Kinds []SymbolKind // the kinds of symbols to remove, all kinds if empty
+	Include []string // glob patterns of the symbols to remove, all symbols if empty
+	Exclude []string // glob patterns of the symbols never to remove
+	Keep  string  // a file listing glob patterns of the symbols never to remove, one per line
+	Mode  MatchMode // how declarations are matched with the src symbols, by name if empty
+	Methods MethodsMode // what happens to the methods of removed types, they are kept if empty unless they are declared in another package than src
+	FailOnConflict bool // whether declarations differing from src are errors instead of warnings in MatchIdentical mode
+	CrossPackage bool // whether to remove symbols from files of another package than the src files
+	SrcImport string // the import path of the src package, references to symbols removed from files of another package are qualified with it
+	Tests bool    // whether to include _test.go files of directories and packages
 	Verbose bool  // whether to output debug statements
-	Stdout  io.Writer // where to write the debug statements
-	symbols map[string]struct{} // symbols found in src
+	DryRun  bool  // whether to only report the symbols that would be removed instead of rewriting the from files
+	PrintDiff bool // whether to print the changes as unified diff instead of rewriting the from files
+	KeepGoing bool // whether to process the remaining files if some src files can't be parsed
+	OutDir  string // the directory to which the from files are written instead of rewriting them in place
+	Atomic  bool  // whether to write the from files only if all of them could be processed, replacing them atomically
+	Verify  bool  // whether to type-check the src files together with the changed from files and the other files of their directories and refuse to write them on errors
+	RefuseSymlinks bool // whether to refuse writing from files that are symbolic links instead of writing to their target
+	Backup  string // the suffix of the backup files keeping the original from files, no backups are kept if empty
+	DumpAST string // the file to which the AST of from files that can't be printed is dumped for debugging
+	Stdout  io.Writer // where to write the debug statements and warnings, they are discarded if nil
+	Stdin   io.Reader // where to read the from file "-" from, defaults to os.Stdin
+	Output  io.Writer // where to write the changed from file "-" to, defaults to Stdout
+	symbols map[string]string // the normalized declarations of the symbols found in src by their qualified keys
+	srcPackage string // the package of the src files, unless CrossPackage is set
+	srcFiles  []string // the Go files denoted by Src
+	fromFiles []string // the Go files denoted by From
+	pending   []*pendingWrite // the changed from files to be written in atomic and verify mode
+	removedNames map[packageKey]*packageNames // the package level names removed from the from files by package
 }
 
+// MatchMode describes when a declaration of a from file is a duplicate of a src symbol.
+type MatchMode string
+
+// The supported match modes.
+const (
+	MatchName      MatchMode = "name"      // declarations having the name of a src symbol are removed
+	MatchIdentical MatchMode = "identical" // only declarations identical to the src declaration are removed
+)
+
+// MethodsMode describes what happens to the methods of the from files whose receiver type is removed.
+type MethodsMode string
+
+// The supported methods modes.
+const (
+	KeepMethods    MethodsMode = "keep"    // the methods are kept and reported, they now belong to the src type; in files of another package they are removed as with CascadeMethods
+	CascadeMethods MethodsMode = "cascade" // the methods are removed together with their receiver type
+)
+
+// DiffSub removes the symbols found in the src files from the from files.
 func (a *Arguments) DiffSub() error {
+	_, err := a.Run()
+	return err
+}
+
+// Run removes the symbols found in the src files from the from files
+// and returns which symbols were removed from which file.
+func (a *Arguments) Run() (*Result, error) {
+	if err := a.prepare(); err != nil {
+		return nil, err
+	}
+	j := &job{
+		src:  readSources(a.srcFiles, a.readFile),
+		from: readSources(a.fromFiles, a.readFile),
+		done: a.writeChanges,
+	}
+	if a.Verify {
+		context, err := a.contextFiles()
+		if err != nil {
+			return nil, err
+		}
+		j.context = readSources(context, a.readFile)
+	}
+	result, errs := a.subtract(j)
+	if result.Files == nil {
+		// the src files could not be read
+		return result, errs.err()
+	}
+	if len(errs) > 0 && len(a.pending) > 0 {
+		a.pending = nil
+		if a.Verbose && len(result.TypeErrors) > 0 {
+			fmt.Fprintf(a.Stdout, "Not writing any changes because the changed files don't compile\n")
+		} else if a.Verbose {
+			fmt.Fprintf(a.Stdout, "Not writing any changes because not all from files could be processed\n")
+		}
+	} else if err := a.commitWrites(); err != nil {
+		errs = append(errs, err)
+	}
+	total := result.Total()
+	if a.Verbose && len(a.fromFiles) > 1 && !a.writesFiles() {
+		fmt.Fprintf(a.Stdout, "Would remove total number of duplicate symbols: %v\n", total)
+	} else if a.Verbose && len(a.fromFiles) > 1 {
+		fmt.Fprintf(a.Stdout, "Removed total number of duplicate symbols: %v\n", total)
+	}
+	err := errs.err()
+	if err == nil && a.DryRun && total > 0 {
+		return result, SymbolsWouldBeRemoved
+	}
+	return result, err
+}
+
+// prepare resolves the src and from files. The debug statements and warnings
+// are discarded if no Stdout is given.
+func (a *Arguments) prepare() error {
+	if a.Stdout == nil {
+		a.Stdout = ioutil.Discard
+	}
 	if len(a.Src) == 0 {
 		return NotEnoughSrcFiles
 	}
 	if len(a.From) == 0 {
 		return NotEnoughFromFiles
 	}
+	if err := a.expandFiles(); err != nil {
+		return err
+	}
 	if err := a.checkFiles(); err != nil {
 		return errors.New("could not read all files")
 	}
-	if a.Verbose {
-		fmt.Fprintf(a.Stdout, "Parsing src files...\n")
+	return nil
+}
+
+// writesFiles reports whether the from files are rewritten.
+func (a *Arguments) writesFiles() bool {
+	return !a.DryRun && !a.PrintDiff
+}
+
+// stdin is the from file denoting the standard input, stdinName is used for it in messages.
+const (
+	stdin     = "-"
+	stdinName = "<standard input>"
+)
+
+func (a *Arguments) stdin() io.Reader {
+	if a.Stdin == nil {
+		return os.Stdin
 	}
-	a.readSymbols()
-	if a.Verbose {
-		fmt.Fprintf(a.Stdout, "Found symbols:\n")
-		a.printSymbols()
-		fmt.Fprintf(a.Stdout, "Removing duplicate symbols...\n")
+	return a.Stdin
+}
+
+// readFile reads a src or from file, "-" is read from Stdin.
+func (a *Arguments) readFile(fileName string) ([]byte, error) {
+	if fileName == stdin {
+		return ioutil.ReadAll(a.stdin())
 	}
-	total, err := a.removeSymbols()
-	if a.Verbose && len(a.From) > 1 {
-		fmt.Fprintf(a.Stdout, "Removed total number of duplicate symbols: %v\n", total)
+	return ioutil.ReadFile(fileName)
+}
+
+func (a *Arguments) output() io.Writer {
+	if a.Output == nil {
+		return a.Stdout
 	}
-	return err
+	return a.Output
+}
+
+// expandFiles resolves the directories and packages given as Src and From to Go files.
+func (a *Arguments) expandFiles() (err error) {
+	if a.srcFiles, err = expandPatterns(a.Src, a.Tests); err != nil {
+		return err
+	}
+	if a.fromFiles, err = expandPatterns(a.From, a.Tests); err != nil {
+		return err
+	}
+	for _, from := range a.fromFiles {
+		if from == stdin && len(a.fromFiles) > 1 {
+			return StdinNotAlone
+		}
+		if from == stdin && a.OutDir != "" {
+			return StdinWithOutDir
+		}
+	}
+	if len(a.srcFiles) == 0 {
+		return NotEnoughSrcFiles
+	}
+	if len(a.fromFiles) == 0 {
+		return NotEnoughFromFiles
+	}
+	return nil
 }
@@ -32,7 +32,7 @@ func checkFile(file string) error {
 }
 
 func (a Arguments) checkFiles() (err error) {
-	for _, src := range a.Src {
+	for _, src := range a.srcFiles {
 		if a.Verbose {
 			fmt.Fprintf(a.Stdout, "Considering src file: %s\n", src)
 		}
@@ -43,10 +43,13 @@ func (a Arguments) checkFiles() (err error) {
 			}
 		}
 	}
-	for _, from := range a.From {
+	for _, from := range a.fromFiles {
 		if a.Verbose {
 			fmt.Fprintf(a.Stdout, "Considering from file: %s\n", from)
 		}
+		if from == stdin {
+			continue
+		}
 		if e := checkFile(from); e != nil {
 			err = e
 			if a.Verbose {
@@ -60,9 +63,17 @@ func (a Arguments) checkFiles() (err error) {
 var (
 	NotEnoughSrcFiles error
 	NotEnoughFromFiles error
+	SymbolsWouldBeRemoved error // returned in dry-run mode when the from files would be changed
+	NoBackupSuffix error
+	StdinNotAlone error
+	StdinWithOutDir error
 )
 
 func init() {
 	NotEnoughSrcFiles = errors.New("not enough src files")
 	NotEnoughFromFiles = errors.New("not enough from files")
+	SymbolsWouldBeRemoved = errors.New("duplicate symbols would be removed")
+	NoBackupSuffix = errors.New("no backup suffix given")
+	StdinNotAlone = errors.New("standard input can only be used as the only from file")
+	StdinWithOutDir = errors.New("standard input is written to standard output, not to an output directory")
 }
@@ -0,0 +1,85 @@
+package diff
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// filterSymbols drops the symbols that are not included or that are excluded
+// or kept from the symbols found in src, so that they are never removed.
+// Patterns are matched against the bare name (e.g. "Len") as well as the
+// qualified key (e.g. "Buffer.Len" or "func:Len") of a symbol.
+func (a *Arguments) filterSymbols() error {
+	keep, err := readKeepFile(a.Keep)
+	if err != nil {
+		return err
+	}
+	for _, patterns := range [][]string{a.Include, a.Exclude, keep} {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("invalid symbol pattern \"%s\": %v", p, err)
+			}
+		}
+	}
+	for _, key := range a.sortedSymbols() {
+		reason := ""
+		if len(a.Include) > 0 && !matchesSymbol(a.Include, key) {
+			reason = "not included"
+		} else if matchesSymbol(a.Exclude, key) {
+			reason = "excluded"
+		} else if matchesSymbol(keep, key) {
+			reason = "kept"
+		}
+		if reason == "" {
+			continue
+		}
+		delete(a.symbols, key)
+		if a.Verbose {
+			fmt.Fprintf(a.Stdout, "Ignoring symbol %s: %s\n", key, reason)
+		}
+	}
+	return nil
+}
+
+// matchesSymbol reports whether any of the patterns matches the symbol.
+func matchesSymbol(patterns []string, key string) bool {
+	name := key[strings.LastIndexAny(key, ":.")+1:]
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// readKeepFile reads the patterns of the symbols to keep, one per line.
+// Empty lines and lines starting with "#" are ignored.
+func readKeepFile(file string) ([]string, error) {
+	if file == "" {
+		return nil, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read keep file: %v", err)
+	}
+	defer f.Close()
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read keep file: %v", err)
+	}
+	return patterns, nil
+}
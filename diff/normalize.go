@@ -0,0 +1,137 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+)
+
+// normalize prints the node without comments and with its original
+// positions stripped, so that differences in layout are ignored.
+func normalize(node ast.Node) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, token.NewFileSet(), node); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// normalizeFunc returns the normalized declaration of a function or method.
+// The type parameters of a generic receiver are given canonical names, as each
+// method may name them differently.
+func normalizeFunc(fd *ast.FuncDecl) string {
+	c := *fd
+	c.Doc = nil
+	params := receiverTypeParams(fd.Recv)
+	if len(params) == 0 {
+		return normalize(&c)
+	}
+	// the names are changed in place while printing and restored afterwards
+	renamed := make(map[*ast.Ident]string)
+	var rename func(node ast.Node) bool
+	rename = func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.SelectorExpr:
+			// selected fields and methods are not type parameters
+			ast.Inspect(n.X, rename)
+			return false
+		case *ast.Ident:
+			if canonical, ok := params[n.Name]; ok {
+				renamed[n] = n.Name
+				n.Name = canonical
+			}
+		}
+		return true
+	}
+	ast.Inspect(&c, rename)
+	defer func() {
+		for id, name := range renamed {
+			id.Name = name
+		}
+	}()
+	return normalize(&c)
+}
+
+// receiverTypeParams returns canonical names for the type parameters of the
+// receiver by their names. The canonical names can't clash with identifiers.
+func receiverTypeParams(recv *ast.FieldList) map[string]string {
+	if recv == nil || len(recv.List) == 0 {
+		return nil
+	}
+	expr := recv.List[0].Type
+	var indices []ast.Expr
+loop:
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			indices = []ast.Expr{e.Index}
+			break loop
+		case *ast.IndexListExpr:
+			indices = e.Indices
+			break loop
+		default:
+			break loop
+		}
+	}
+	params := make(map[string]string)
+	for i, index := range indices {
+		if id, ok := index.(*ast.Ident); ok && id.Name != "_" {
+			params[id.Name] = fmt.Sprintf("$%d", i)
+		}
+	}
+	return params
+}
+
+// normalizeType returns the normalized declaration of a type.
+func normalizeType(ts *ast.TypeSpec) string {
+	c := *ts
+	c.Doc, c.Comment = nil, nil
+	return "type " + normalize(&c)
+}
+
+// normalizeValue returns the normalized declaration of the j-th name of
+// the i-th spec of a variable or constant declaration.
+func normalizeValue(d *ast.GenDecl, i int, j int) string {
+	s := d.Specs[i].(*ast.ValueSpec)
+	spec := &ast.ValueSpec{Names: []*ast.Ident{s.Names[j]}, Type: s.Type}
+	values := s.Values
+	if d.Tok == token.CONST {
+		// an omitted constant expression repeats the previous one
+		for k := i - 1; k >= 0 && len(values) == 0; k-- {
+			if prev, ok := d.Specs[k].(*ast.ValueSpec); ok {
+				spec.Type, values = prev.Type, prev.Values
+			}
+		}
+	}
+	switch {
+	case len(values) == len(s.Names):
+		spec.Values = []ast.Expr{values[j]}
+	case len(values) > 0:
+		// the values of a multi-value expression depend on all names
+		spec.Names, spec.Values = s.Names, values
+	}
+	decl := d.Tok.String() + " " + normalize(spec)
+	if d.Tok == token.CONST && usesIota(spec.Values) {
+		decl += fmt.Sprintf(" // iota = %d", i)
+	}
+	return decl
+}
+
+// usesIota reports whether any of the expressions refers to iota.
+func usesIota(exprs []ast.Expr) (found bool) {
+	for _, e := range exprs {
+		ast.Inspect(e, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && id.Name == "iota" {
+				found = true
+			}
+			return !found
+		})
+	}
+	return
+}
@@ -0,0 +1,109 @@
+package diff
+
+import (
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expandPatterns resolves the given arguments to the Go files they denote.
+// An argument may be a file, a directory, a directory followed by "/..."
+// to include all of its subdirectories, or an import path (optionally
+// followed by "/..." as well). Test files are only included from directories
+// and packages if tests is true, explicitly given files are always included.
+func expandPatterns(patterns []string, tests bool) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		expanded, err := expandPattern(pattern, tests)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, expanded...)
+	}
+	return files, nil
+}
+
+func expandPattern(pattern string, tests bool) ([]string, error) {
+	if pattern == stdin {
+		return []string{pattern}, nil
+	}
+	recursive := pattern == "..." || strings.HasSuffix(pattern, "/...")
+	dir := strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+	if recursive && dir == "" {
+		dir = "."
+	}
+	if s, err := os.Stat(dir); err == nil {
+		if !s.IsDir() {
+			return []string{pattern}, nil
+		}
+	} else if isImportPath(dir) {
+		p, err := build.Import(dir, ".", build.FindOnly)
+		if err != nil {
+			return nil, fmt.Errorf("could not find package %s: %v", dir, err)
+		}
+		dir = p.Dir
+	} else {
+		// let checkFile report the missing file
+		return []string{pattern}, nil
+	}
+	if !recursive {
+		return goFiles(dir, tests)
+	}
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != dir && ignoredDir(info.Name()) {
+			return filepath.SkipDir
+		}
+		dirFiles, err := goFiles(path, tests)
+		files = append(files, dirFiles...)
+		return err
+	})
+	return files, err
+}
+
+// goFiles returns the Go files in the directory, the same way as the go tool
+// considers them: files starting with "." or "_" are ignored, as well as files
+// excluded by build constraints or GOOS/GOARCH suffixes for the current platform.
+func goFiles(dir string, tests bool) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read directory: %v", err)
+	}
+	var files []string
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, ".go") {
+			continue
+		}
+		if !tests && strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if match, err := build.Default.MatchFile(dir, name); err != nil {
+			return nil, fmt.Errorf("could not read build constraints: %v", err)
+		} else if !match {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	return files, nil
+}
+
+// ignoredDir reports whether a directory is skipped by "/..." patterns.
+func ignoredDir(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor"
+}
+
+// isImportPath reports whether the argument should be resolved as import path
+// instead of as a path in the file system.
+func isImportPath(arg string) bool {
+	return arg != "" && !build.IsLocalImport(arg) && !filepath.IsAbs(arg) && !strings.HasSuffix(arg, ".go")
+}
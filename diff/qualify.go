@@ -0,0 +1,143 @@
+package diff
+
+import (
+	"go/ast"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// crossPackage reports whether symbols may be removed from files of another package than src.
+func (a *Arguments) crossPackage() bool {
+	return a.CrossPackage || a.SrcImport != ""
+}
+
+// qualifies reports whether references to the src symbols removed from a from
+// file of the given package have to be qualified with the src package.
+func (a *Arguments) qualifies(pkg string) bool {
+	return a.SrcImport != "" && pkg != a.srcPackage
+}
+
+// qualifyReferences rewrites the references to the given package level names
+// to refer to the src package instead and adds its import to the file. The
+// package is imported under an alias if its name is taken in the file or by
+// the names kept in the package. The rewritten names are returned in sorted order.
+func (a *Arguments) qualifyReferences(fset *token.FileSet, f *ast.File, names map[string]SymbolKind, kept map[string]bool) []string {
+	unresolved := make(map[*ast.Ident]bool, len(f.Unresolved))
+	for _, id := range f.Unresolved {
+		unresolved[id] = true
+	}
+	pkg, imported := a.importName(f)
+	if !imported {
+		taken := takenNames(f)
+		for i := 1; taken[pkg] || kept[pkg]; i++ {
+			pkg = a.srcPackage + strconv.Itoa(i)
+		}
+	}
+	fieldKeys := compositeLitKeys(f)
+	qualified := make(map[string]bool)
+	astutil.Apply(f, func(cursor *astutil.Cursor) bool {
+		id, ok := cursor.Node().(*ast.Ident)
+		if !ok || fieldKeys[id] {
+			return true
+		}
+		if _, ok := names[id.Name]; !ok {
+			return true
+		}
+		// a reference to a package level symbol declared in this file or in another file of the package
+		if !unresolved[id] && (id.Obj == nil || id.Obj != f.Scope.Lookup(id.Name)) {
+			return true
+		}
+		cursor.Replace(&ast.SelectorExpr{
+			X:   &ast.Ident{NamePos: id.NamePos, Name: pkg},
+			Sel: &ast.Ident{NamePos: id.NamePos, Name: id.Name},
+		})
+		qualified[id.Name] = true
+		return true
+	}, nil)
+	if len(qualified) == 0 {
+		return nil
+	}
+	if !imported && pkg == path.Base(a.SrcImport) && pkg == a.srcPackage {
+		astutil.AddImport(fset, f, a.SrcImport)
+	} else if !imported {
+		astutil.AddNamedImport(fset, f, pkg, a.SrcImport)
+	}
+	return sortedKeys(qualified)
+}
+
+// sortedKeys returns the keys of the set in sorted order.
+func sortedKeys(set map[string]bool) []string {
+	result := make([]string, 0, len(set))
+	for name := range set {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// importName returns the name under which the src package is referred to in
+// the file, and whether the file imports it already.
+func (a *Arguments) importName(f *ast.File) (string, bool) {
+	for _, imp := range f.Imports {
+		if importPath(imp) != a.SrcImport {
+			continue
+		}
+		if imp.Name == nil {
+			return a.srcPackage, true
+		}
+		if imp.Name.Name != "_" && imp.Name.Name != "." {
+			return imp.Name.Name, true
+		}
+	}
+	return a.srcPackage, false
+}
+
+// takenNames returns the identifiers used in the file that an import name
+// would clash with or be shadowed by. Selected fields and methods don't count.
+func takenNames(f *ast.File) map[string]bool {
+	taken := make(map[string]bool)
+	var collect func(node ast.Node) bool
+	collect = func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.SelectorExpr:
+			ast.Inspect(n.X, collect)
+			return false
+		case *ast.Ident:
+			taken[n.Name] = true
+		}
+		return true
+	}
+	for _, decl := range f.Decls {
+		ast.Inspect(decl, collect)
+	}
+	return taken
+}
+
+// compositeLitKeys returns the keys of composite literals that are likely
+// field names of struct literals rather than references to symbols.
+func compositeLitKeys(f *ast.File) map[*ast.Ident]bool {
+	keys := make(map[*ast.Ident]bool)
+	ast.Inspect(f, func(node ast.Node) bool {
+		lit, ok := node.(*ast.CompositeLit)
+		if !ok {
+			return true
+		}
+		switch lit.Type.(type) {
+		case *ast.MapType, *ast.ArrayType:
+			return true
+		}
+		for _, elt := range lit.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				if id, ok := kv.Key.(*ast.Ident); ok {
+					keys[id] = true
+				}
+			}
+		}
+		return true
+	})
+	return keys
+}
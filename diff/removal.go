@@ -8,53 +8,226 @@ import (
 	"fmt"
 	"go/format"
 	"bytes"
-	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
-func (a *Arguments) removeSymbols() (int, error) {
-	var err error
-	var totalDuplicateSymbols int
-	for _, from := range a.From {
-		dup, e := a.removeSymbolsFromFile(from)
-		totalDuplicateSymbols += dup
-		if e != nil {
-			err = e
-			if a.Verbose {
-				fmt.Fprintf(a.Stdout, "Error removing symobls from file \"%s\": %v\n", from, e)
-			}
-		} else if a.Verbose {
-			fmt.Fprintf(a.Stdout, "Removed %v duplicate symbols from %s\n", dup, from)
+// srcSymbol returns the key of the src symbol the declaration of a from file
+// in the given package duplicates.
+func (a *Arguments) srcSymbol(kind SymbolKind, recv string, name string, pkg string) (string, bool) {
+	if !a.removesKind(kind) {
+		return "", false
+	}
+	if isSpecialSymbol(kind, name, pkg) && !a.requested(kind, recv, name) {
+		return "", false
+	}
+	if kind == MethodSymbol {
+		key := symbolKey(kind, recv, name)
+		_, ok := a.symbols[key]
+		return key, ok
+	}
+	return a.topLevelSymbol(name)
+}
+
+// removedTopLevel returns the package level names declared in the from file
+// that are going to be removed together with their kind.
+func (a *Arguments) removedTopLevel(f *ast.File) map[string]SymbolKind {
+	names := make(map[string]SymbolKind)
+	ast.Walk(&visitor{func(kind SymbolKind, recv string, name *ast.Ident, decl string) {
+		if kind == MethodSymbol || (a.qualifies(f.Name.Name) && !ast.IsExported(name.Name)) {
+			return
+		}
+		key, ok := a.srcSymbol(kind, recv, name.Name, f.Name.Name)
+		if ok && (a.Mode != MatchIdentical || a.symbols[key] == decl) {
+			names[name.Name] = kind
 		}
+	}}, f)
+	return names
+}
+
+// packageKey identifies the package of from files by their directory and package clause.
+type packageKey struct {
+	dir  string
+	name string
+}
+
+// packageNames are the package level names declared in the from files of a package.
+type packageNames struct {
+	removed map[string]SymbolKind // the names that are going to be removed from any of the files
+	kept    map[string]bool       // the names that are declared and not removed
+}
+
+// fromPackage returns the names of the package the from file belongs to.
+func (a *Arguments) fromPackage(fileName string, f *ast.File) *packageNames {
+	key := packageKey{filepath.Dir(fileName), f.Name.Name}
+	names, ok := a.removedNames[key]
+	if !ok {
+		names = &packageNames{removed: make(map[string]SymbolKind), kept: make(map[string]bool)}
+		a.removedNames[key] = names
 	}
-	return totalDuplicateSymbols, err
+	return names
 }
 
-func (a *Arguments) removeSymbolsFromFile(fileName string) (int, error) {
+// addRemovedNames adds the package level names that are going to be removed
+// from the source of a from file to the removed names of its package, as well
+// as the names that are kept.
+func (a *Arguments) addRemovedNames(fileName string, src []byte) {
+	// files that can't be parsed are reported when their symbols are removed
+	f, err := parser.ParseFile(token.NewFileSet(), fileName, src, 0)
+	if err != nil {
+		return
+	}
+	names := a.fromPackage(fileName, f)
+	removed := a.removedTopLevel(f)
+	for name, kind := range removed {
+		names.removed[name] = kind
+	}
+	ast.Walk(&visitor{func(kind SymbolKind, recv string, name *ast.Ident, decl string) {
+		if _, ok := removed[name.Name]; kind != MethodSymbol && !ok {
+			names.kept[name.Name] = true
+		}
+	}}, f)
+}
+
+// writeChanges prints or writes the changed source of a from file.
+func (a *Arguments) writeChanges(result *FileResult, src []byte, out []byte) (err error) {
+	fileName := result.File
+	if a.PrintDiff && fileName == stdinName {
+		// the standard output receives the changes of the standard input
+		a.output().Write(unifiedDiff(fileName, src, out))
+	} else if a.PrintDiff {
+		a.Stdout.Write(unifiedDiff(fileName, src, out))
+	}
+	if fileName == stdinName && a.Verify {
+		if a.writesFiles() {
+			// written once the changes were verified
+			a.pending = append(a.pending, &pendingWrite{result: result, content: out, target: stdin})
+		}
+		return nil
+	}
+	if fileName == stdinName {
+		if a.writesFiles() {
+			_, err = a.output().Write(out)
+			result.Written = err == nil
+		}
+		return err
+	}
+	// write changes to file, the output directory has to contain all from files
+	if a.writesFiles() && (result.changed() || a.OutDir != "") {
+		err = a.writeFile(result, src, out)
+	}
+	return err
+}
+
+// removeSymbolsFromSource removes the symbols found in src from the source of
+// a from file and returns the changed source. The source is returned as is
+// if nothing was removed.
+func (a *Arguments) removeSymbolsFromSource(fileName string, src []byte) (*FileResult, []byte, error) {
+	result := &FileResult{File: fileName}
 	fset := token.NewFileSet() // positions are relative to fset
-	f, err := parser.ParseFile(fset, fileName, nil, 0)
+	f, err := parser.ParseFile(fset, fileName, src, parser.ParseComments)
 	if err != nil {
-		return 0, err
+		return result, nil, err
 	}
-	var duplicateSymbols int
-	hasSymbol := func(symbol string) bool {
-		_, ok := a.symbols[symbol]
-		return ok
+	if !a.crossPackage() && a.srcPackage != "" && f.Name.Name != a.srcPackage {
+		return result, nil, fmt.Errorf("package %s of from file \"%s\" differs from package %s of the src files", f.Name.Name, fileName, a.srcPackage)
 	}
-	hasIdent := func(ident *ast.Ident) bool {
+	imports := usedImports(f)
+	var removedRanges []sourceRange
+	genDecls := make(map[*ast.GenDecl]genDeclInfo)
+	deleteNode := func(cursor *astutil.Cursor) {
+		removedRanges = append(removedRanges, declRange(cursor.Node()))
+		cursor.Delete()
+	}
+	removed := func(kind SymbolKind, recv string, name *ast.Ident, r sourceRange) {
+		symbol := RemovedSymbol{
+			Kind:   kind,
+			Name:   symbolKey(kind, recv, name.Name),
+			Pos:    fset.Position(name.Pos()),
+			Offset: fset.Position(r.pos).Offset,
+			End:    fset.Position(r.end).Offset,
+		}
+		result.Removed = append(result.Removed, symbol)
+		if a.DryRun {
+			fmt.Fprintf(a.Stdout, "%v: would remove %s\n", symbol.Pos, symbol.Name)
+		}
+	}
+	// removing the only spec of a declaration without parentheses removes the whole declaration
+	specRange := func(cursor *astutil.Cursor) sourceRange {
+		if d, ok := cursor.Parent().(*ast.GenDecl); ok && !d.Lparen.IsValid() {
+			return declRange(d)
+		}
+		return declRange(cursor.Node())
+	}
+	pkg := a.fromPackage(fileName, f)
+	removedNames := a.removedTopLevel(f)
+	for name, kind := range pkg.removed {
+		removedNames[name] = kind
+	}
+	decls := make(map[*ast.Ident]string)
+	ast.Walk(&visitor{func(kind SymbolKind, recv string, name *ast.Ident, decl string) {
+		decls[name] = decl
+	}}, f)
+	// matches reports whether the declaration of the name duplicates a symbol found in src,
+	// the declarations that are kept nevertheless are reported if report is set
+	matches := func(kind SymbolKind, recv string, ident *ast.Ident, report bool) bool {
 		if ident == nil {
 			return false
 		}
-		return hasSymbol(ident.Name)
+		key, ok := a.srcSymbol(kind, recv, ident.Name, f.Name.Name)
+		if !ok {
+			return false
+		}
+		if a.qualifies(f.Name.Name) && !ast.IsExported(ident.Name) {
+			if !report {
+				return false
+			}
+			// the src declaration can't be referred to from another package
+			name := symbolKey(kind, recv, ident.Name)
+			result.Unexported = append(result.Unexported, name)
+			fmt.Fprintf(a.Stdout, "%v: warning: keeping %s, it is not exported by %s\n", fset.Position(ident.Pos()), name, a.SrcImport)
+			return false
+		}
+		if a.Mode == MatchIdentical && a.symbols[key] != decls[ident] {
+			if !report {
+				return false
+			}
+			c := Conflict{
+				Kind: kind,
+				Name: symbolKey(kind, recv, ident.Name),
+				Pos:  fset.Position(ident.Pos()),
+				Src:  a.symbols[key],
+				From: decls[ident],
+			}
+			result.Conflicts = append(result.Conflicts, c)
+			if !a.FailOnConflict {
+				fmt.Fprintf(a.Stdout, "%v: warning: %s differs from the src declaration\n", c.Pos, c.Name)
+			}
+			return false
+		}
+		return true
 	}
-	removeIfSymbolExists := func(cursor *astutil.Cursor, ident *ast.Ident) {
-		if hasIdent(ident) {
-			duplicateSymbols++
-			cursor.Delete()
+	hasIdent := func(kind SymbolKind, ident *ast.Ident) bool {
+		return matches(kind, "", ident, true)
+	}
+	// keptConst reports whether a name of the constant spec is kept, without reporting anything
+	keptConst := func(spec *ast.ValueSpec) bool {
+		for _, name := range spec.Names {
+			if !matches(ConstSymbol, "", name, false) {
+				return true
+			}
 		}
+		return false
 	}
-	removeIfEmptyNames := func(cursor *astutil.Cursor, vs *ast.ValueSpec) {
-		if len(vs.Names) == 0 {
-			cursor.Delete()
+	hasMethod := func(fd *ast.FuncDecl) bool {
+		return matches(MethodSymbol, receiverType(fd.Recv), fd.Name, true)
+	}
+	removeIfSymbolExists := func(cursor *astutil.Cursor, kind SymbolKind, ident *ast.Ident) {
+		if hasIdent(kind, ident) {
+			removed(kind, "", ident, specRange(cursor))
+			deleteNode(cursor)
 		}
 	}
 	removeSymbols := func(cursor *astutil.Cursor) bool {
@@ -64,31 +237,102 @@ func (a *Arguments) removeSymbolsFromFile(fileName string) (int, error) {
 		node := cursor.Node()
 		switch n := node.(type) {
 		case *ast.FuncDecl:
-			removeIfSymbolExists(cursor, n.Name)
+			if n.Recv == nil {
+				removeIfSymbolExists(cursor, FuncSymbol, n.Name)
+			} else if hasMethod(n) {
+				removed(MethodSymbol, receiverType(n.Recv), n.Name, declRange(n))
+				deleteNode(cursor)
+			} else if recv := receiverType(n.Recv); removedNames[recv] == TypeSymbol && !pkg.kept[recv] {
+				// the receiver type is removed, so the method would belong to the src type
+				if a.Methods == CascadeMethods {
+					removed(MethodSymbol, recv, n.Name, declRange(n))
+					deleteNode(cursor)
+				} else if f.Name.Name != a.srcPackage {
+					// methods can't be declared on the type of another package
+					fmt.Fprintf(a.Stdout, "%v: warning: removing %s, the methods of the src type can't be declared in package %s\n", fset.Position(n.Name.Pos()), symbolKey(MethodSymbol, recv, n.Name.Name), f.Name.Name)
+					removed(MethodSymbol, recv, n.Name, declRange(n))
+					deleteNode(cursor)
+				} else {
+					result.Attached = append(result.Attached, symbolKey(MethodSymbol, recv, n.Name.Name))
+				}
+			}
 			return false
 		case *ast.GenDecl:
 			if n.Tok == token.IMPORT {
 				return false
 			}
+			// the range can't be determined anymore once all specs are removed
+			info := genDeclInfo{r: declRange(n)}
+			if len(n.Specs) > 0 {
+				info.first = n.Specs[0]
+			}
+			genDecls[n] = info
 		case *ast.ValueSpec:
+			kind := VarSymbol
+			var reliedOn bool
+			if d, ok := cursor.Parent().(*ast.GenDecl); ok && d.Tok == token.CONST {
+				kind = ConstSymbol
+				reliedOn = specReliedOn(d, n, keptConst)
+			}
 			var newNames []*ast.Ident
-			for _, n := range n.Names {
-				if hasIdent(n) {
-					duplicateSymbols++
+			var newValues []ast.Expr
+			var removedNames int
+			remove := make([]bool, len(n.Names))
+			for i, name := range n.Names {
+				remove[i] = hasIdent(kind, name)
+			}
+			for i, name := range n.Names {
+				if remove[i] {
+					removedNames++
+				} else {
+					newNames = append(newNames, name)
+					if len(n.Values) == len(n.Names) {
+						newValues = append(newValues, n.Values[i])
+					}
+				}
+			}
+			for i, name := range n.Names {
+				if !remove[i] {
+					continue
+				}
+				if len(newNames) == 0 {
+					removed(kind, "", name, specRange(cursor))
 				} else {
-					newNames = append(newNames, n)
+					removed(kind, "", name, declRange(name))
 				}
+				if reliedOn || (len(n.Values) > 0 && len(n.Values) != len(n.Names)) {
+					// the values of a multi-value expression can't be removed individually,
+					// nor can the specs of constants the following specs depend on
+					name.Name = "_"
+				}
+			}
+			if reliedOn {
+				return false
+			}
+			if len(newNames) == 0 {
+				deleteNode(cursor)
+			} else if removedNames > 0 && (len(n.Values) == 0 || len(n.Values) == len(n.Names)) {
+				n.Names = newNames
+				n.Values = newValues
 			}
-			n.Names = newNames
-			removeIfEmptyNames(cursor, n)
 			return false
 		case *ast.TypeSpec:
-			removeIfSymbolExists(cursor, n.Name)
+			removeIfSymbolExists(cursor, TypeSymbol, n.Name)
 			return false
 		}
 		return true
 	}
 	astutil.Apply(f, removeSymbols, nil)
+	if a.FailOnConflict && len(result.Conflicts) > 0 {
+		names := make([]string, len(result.Conflicts))
+		for i, c := range result.Conflicts {
+			names[i] = c.Name
+		}
+		return result, nil, fmt.Errorf("declarations in \"%s\" differ from the src declarations: %s", fileName, strings.Join(names, ", "))
+	}
+	if a.qualifies(f.Name.Name) {
+		result.Qualified = a.qualifyReferences(fset, f, removedNames, pkg.kept)
+	}
 	removeEmptyGenDecls := func(cursor *astutil.Cursor) bool {
 		if cursor == nil {
 			return true
@@ -99,38 +343,210 @@ func (a *Arguments) removeSymbolsFromFile(fileName string) (int, error) {
 			if n.Tok == token.IMPORT {
 				return false
 			}
+			info, ok := genDecls[n]
 			if len(n.Specs) == 0 {
+				removedRanges = append(removedRanges, info.r)
 				cursor.Delete()
+			} else if ok && n.Lparen.IsValid() && n.Specs[0] != info.first {
+				avoidLeadingBlankLine(fset, n)
 			}
 		}
 		return true
 	}
 	astutil.Apply(f, removeEmptyGenDecls, nil)
+	for _, imp := range imports {
+		path := importPath(imp)
+		if astutil.UsesImport(f, path) {
+			continue
+		}
+		removedRanges = append(removedRanges, importRange(f, imp))
+		if imp.Doc != nil {
+			// DeleteNamedImport only closes the hole of the import line itself
+			file := fset.File(imp.Pos())
+			for n := file.Line(imp.Pos()) - file.Line(imp.Doc.Pos()); n > 0; n-- {
+				file.MergeLine(file.Line(imp.Doc.Pos()))
+			}
+		}
+		name := ""
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		astutil.DeleteNamedImport(fset, f, name, path)
+		result.RemovedImports = append(result.RemovedImports, path)
+		if a.Verbose && a.writesFiles() {
+			fmt.Fprintf(a.Stdout, "Removed unused import %s from %s\n", imp.Path.Value, fileName)
+		} else if a.Verbose {
+			fmt.Fprintf(a.Stdout, "Would remove unused import %s from %s\n", imp.Path.Value, fileName)
+		}
+	}
+	removeComments(fset, f, removedRanges)
 
-	// write changes to file
-	if duplicateSymbols > 0 {
-		var buf bytes.Buffer
-		if err := format.Node(&buf, fset, f); err != nil {
-			handleAstError(fset, f, err)
+	if !result.changed() {
+		return result, src, nil
+	}
+	var buf bytes.Buffer
+	if err := formatNode(&buf, fset, f); err != nil {
+		if a.DumpAST != "" {
+			a.handleAstError(fset, f, err)
 		}
-		err = ioutil.WriteFile(fileName, []byte(buf.String()), 0644)
-		if err != nil {
-			return 0, fmt.Errorf("writing changed file \"%s\" failed: %v", fileName, err)
+		return result, nil, &FormatError{File: fileName, Err: err}
+	}
+	return result, buf.Bytes(), nil
+}
+
+// specReliedOn reports whether a following spec of the constant declaration
+// that is kept depends on the spec, either by repeating its values implicitly
+// or through the value of iota, which changes if the spec is removed.
+func specReliedOn(d *ast.GenDecl, spec *ast.ValueSpec, kept func(*ast.ValueSpec) bool) bool {
+	found := false
+	var last *ast.ValueSpec // the last spec with values, which is repeated by specs without
+	for _, s := range d.Specs {
+		v := s.(*ast.ValueSpec)
+		if len(v.Values) > 0 {
+			last = v
+		}
+		if v == spec {
+			found = true
+			continue
+		}
+		if !found || last == nil || !kept(v) {
+			continue
+		}
+		if last == spec || usesIota(last.Values) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeComments drops all comments of the file that belong to one of the
+// removed nodes: their doc comments, comments inside of them and comments
+// trailing on the line they end. Otherwise the printer would reattach these
+// comments to the neighbouring declarations.
+func removeComments(fset *token.FileSet, f *ast.File, removed []sourceRange) {
+	if len(removed) == 0 {
+		return
+	}
+	belongsToRemoved := func(cg *ast.CommentGroup) bool {
+		for _, r := range removed {
+			if r.pos <= cg.Pos() && cg.End() <= r.end {
+				return true
+			}
+			if cg.Pos() >= r.end && fset.Position(cg.Pos()).Line == fset.Position(r.end).Line {
+				return true
+			}
+		}
+		return false
+	}
+	var comments []*ast.CommentGroup
+	for _, cg := range f.Comments {
+		if !belongsToRemoved(cg) {
+			comments = append(comments, cg)
 		}
 	}
-	return duplicateSymbols, nil
+	f.Comments = comments
+}
+
+// usedImports returns the imports of the file that are in use.
+// Imports of "C" are never considered as they carry the cgo preamble.
+func usedImports(f *ast.File) []*ast.ImportSpec {
+	var used []*ast.ImportSpec
+	for _, imp := range f.Imports {
+		path := importPath(imp)
+		if path != "C" && astutil.UsesImport(f, path) {
+			used = append(used, imp)
+		}
+	}
+	return used
+}
+
+func importPath(imp *ast.ImportSpec) string {
+	path, _ := strconv.Unquote(imp.Path.Value)
+	return path
+}
+
+// importRange returns the source range of the import including its comments,
+// or of the whole import declaration if it is the only import in it.
+func importRange(f *ast.File, imp *ast.ImportSpec) sourceRange {
+	for _, decl := range f.Decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT && len(d.Specs) == 1 && d.Specs[0] == imp {
+			return declRange(d)
+		}
+	}
+	return declRange(imp)
+}
+
+// genDeclInfo remembers the state of a declaration before symbols were removed from it.
+type genDeclInfo struct {
+	r     sourceRange
+	first ast.Spec
+}
+
+// avoidLeadingBlankLine moves the opening parenthesis of a declaration whose
+// leading specs were removed to the line before its new first spec.
+// Otherwise the printer would keep the gap of the removed specs as a blank line.
+func avoidLeadingBlankLine(fset *token.FileSet, d *ast.GenDecl) {
+	file := fset.File(d.Lparen)
+	line := file.Line(declRange(d.Specs[0]).pos)
+	if line > file.Line(d.Lparen)+1 {
+		d.Lparen = file.LineStart(line) - 1
+	}
+}
+
+// sourceRange is the range of source code covered by a node.
+type sourceRange struct {
+	pos, end token.Pos
+}
+
+// declRange returns the source range of a declaration including its doc and line comments.
+func declRange(node ast.Node) sourceRange {
+	pos, end := node.Pos(), node.End()
+	var doc, comment *ast.CommentGroup
+	switch n := node.(type) {
+	case *ast.FuncDecl:
+		doc = n.Doc
+	case *ast.GenDecl:
+		doc = n.Doc
+	case *ast.TypeSpec:
+		doc, comment = n.Doc, n.Comment
+	case *ast.ValueSpec:
+		doc, comment = n.Doc, n.Comment
+	case *ast.ImportSpec:
+		doc, comment = n.Doc, n.Comment
+	}
+	if doc != nil {
+		pos = doc.Pos()
+	}
+	if comment != nil {
+		end = comment.End()
+	}
+	return sourceRange{pos, end}
+}
+
+// formatNode prints the changed from files, tests replace it to provoke a FormatError.
+var formatNode = format.Node
+
+// FormatError is returned if a from file can't be printed after removing the
+// symbols from its AST. The file is left untouched in this case.
+type FormatError struct {
+	File string // the from file
+	Err  error  // the error returned by format.Node
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("formatting changed file \"%s\" failed: %v", e.File, e.Err)
 }
 
 // copied from c2go
-func handleAstError(fset *token.FileSet, f *ast.File, err error) {
+func (a *Arguments) handleAstError(fset *token.FileSet, f *ast.File, err error) {
 	// Printing the entire AST will generate a lot of output. However, it is
 	// the only way to debug this type of error. Hopefully the error
-	// (printed immediately afterwards) will give a clue.
+	// (printed at the top of the dump) will give a clue.
 	//
 	// You may see an error like:
 	//
-	//     panic: format.Node internal error (692:23: expected selector or
-	//     type assertion, found '[')
+	//     formatting changed file "b.go" failed: format.Node internal error
+	//     (692:23: expected selector or type assertion, found '[')
 	//
 	// This means that when Go was trying to convert the Go AST to source
 	// code it has come across a value or attribute that is illegal.
@@ -150,16 +566,16 @@ func handleAstError(fset *token.FileSet, f *ast.File, err error) {
 	//
 	// The first step is to filter down the AST output to probably lines.
 	// In the error message it said that there was a misplaced "[" so that's
-	// what we will search for. Using the original command (that generated
-	// thousands of lines) we will add two grep filters:
+	// what we will search for. Using the file the AST was dumped to (which
+	// has thousands of lines) we will add two grep filters:
 	//
-	//     go test ... | grep "\[" | grep -v '{$'
-	//     #                   |     |
-	//     #                   |     ^ This excludes lines that end with "{"
-	//     #                   |       which almost certainly won't be what
-	//     #                   |       we are looking for.
-	//     #                   |
-	//     #                   ^ This is the character we are looking for.
+	//     grep "\[" ast.txt | grep -v '{$'
+	//     #     |             |
+	//     #     |             ^ This excludes lines that end with "{"
+	//     #     |               which almost certainly won't be what
+	//     #     |               we are looking for.
+	//     #     |
+	//     #     ^ This is the character we are looking for.
 	//
 	// Hopefully in the output you should see some lines, like (some lines
 	// removed for brevity):
@@ -173,7 +589,14 @@ func handleAstError(fset *token.FileSet, f *ast.File, err error) {
 	// Looking at the full output of the AST (thousands of lines) and
 	// looking at those line numbers should give you a good idea where the
 	// error is coming from; by looking at the parents of the bad lines.
-	_ = ast.Print(fset, f)
-
-	panic(err)
+	out, e := os.OpenFile(a.DumpAST, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if e != nil {
+		fmt.Fprintf(a.Stdout, "Could not dump AST: %v\n", e)
+		return
+	}
+	defer out.Close()
+	fmt.Fprintf(out, "%s: %v\n", fset.File(f.Pos()).Name(), err)
+	if e := ast.Fprint(out, fset, f, nil); e != nil {
+		fmt.Fprintf(a.Stdout, "Could not dump AST: %v\n", e)
+	}
 }
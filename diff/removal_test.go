@@ -0,0 +1,55 @@
+package diff
+
+import (
+	"errors"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFormatError tests that a from file that can't be printed is left
+// untouched and its AST is appended to the DumpAST file.
+func TestFormatError(t *testing.T) {
+	dir := t.TempDir()
+	src, from, dump := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go"), filepath.Join(dir, "ast.txt")
+	original := "package main\n\nfunc F() {}\n\nfunc G() {}\n"
+	files := map[string]string{
+		src:  "package main\n\nfunc F() {}\n",
+		from: original,
+		dump: "previous dump\n",
+	}
+	for file, content := range files {
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	formatErr := errors.New("unprintable node")
+	defer func(f func(io.Writer, *token.FileSet, interface{}) error) {
+		formatNode = f
+	}(formatNode)
+	formatNode = func(io.Writer, *token.FileSet, interface{}) error {
+		return formatErr
+	}
+	a := &Arguments{Src: []string{src}, From: []string{from}, DumpAST: dump}
+	_, err := a.Run()
+	var fe *FormatError
+	if !errors.As(err, &fe) || fe.File != from || fe.Err != formatErr {
+		t.Fatalf("expected FormatError of %s, got %v", from, err)
+	}
+	if content, err := ioutil.ReadFile(from); err != nil {
+		t.Fatal(err)
+	} else if string(content) != original {
+		t.Errorf("expected untouched from file, got %q", content)
+	}
+	content, err := ioutil.ReadFile(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := "previous dump\n" + from + ": unprintable node\n"
+	if !strings.HasPrefix(string(content), header) || !strings.Contains(string(content), "*ast.File") {
+		t.Errorf("expected AST appended to the dump, got %q", content)
+	}
+}
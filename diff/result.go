@@ -0,0 +1,81 @@
+package diff
+
+import (
+	"go/token"
+	"strings"
+)
+
+// Result of the diff-sub algorithm
+type Result struct {
+	Symbols    []string      // qualified keys of the symbols found in src
+	Files      []*FileResult // the results for each from file
+	SrcErrors  []string      `json:",omitempty"` // why src files could not be parsed
+	TypeErrors []string      `json:",omitempty"` // why the changed files don't compile in verify mode
+}
+
+// FileResult lists the changes made to a single from file.
+type FileResult struct {
+	File           string          // the from file
+	Removed        []RemovedSymbol // the symbols removed from the file
+	RemovedImports []string        // the paths of the imports removed because they became unused
+	Conflicts      []Conflict      `json:",omitempty"` // the symbols not removed because their declarations differ from src
+	Unexported     []string        `json:",omitempty"` // the symbols not removed because src doesn't export them to another package
+	Qualified      []string        `json:",omitempty"` // the names whose references were qualified with the src package
+	Attached       []string        `json:",omitempty"` // the methods kept although their receiver type was removed
+	Written        bool            // whether the changed file (or the file in the output directory) was written
+	Output         string          `json:",omitempty"` // the file written in the output directory
+	Error          string          `json:",omitempty"` // why the file could not be processed
+}
+
+// RemovedSymbol describes a symbol that was removed from a from file.
+type RemovedSymbol struct {
+	Kind   SymbolKind     // the kind of the removed declaration
+	Name   string         // the qualified name of the symbol, e.g. "Buffer.Len" or "func:Len"
+	Pos    token.Position // the position of the symbol's name in the original file
+	Offset int            // the byte offset of the removed declaration in the original file
+	End    int            // the byte offset right after the removed declaration in the original file
+}
+
+// changed reports whether the from file was changed.
+func (r *FileResult) changed() bool {
+	return len(r.Removed) > 0 || len(r.Qualified) > 0
+}
+
+// Conflict describes a symbol declared in src and in a from file whose declarations differ.
+type Conflict struct {
+	Kind SymbolKind     // the kind of the declaration in the from file
+	Name string         // the qualified name of the symbol in the from file
+	Pos  token.Position // the position of the symbol's name in the from file
+	Src  string         // the normalized declaration in src
+	From string         // the normalized declaration in the from file
+}
+
+// Total returns the number of symbols removed from all from files.
+func (r *Result) Total() (total int) {
+	for _, f := range r.Files {
+		total += len(f.Removed)
+	}
+	return
+}
+
+// FileErrors lists the errors of all files that could not be processed.
+type FileErrors []error
+
+func (e FileErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// err returns nil if there are no errors and the error itself if there is only one.
+func (e FileErrors) err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	}
+	return e
+}
@@ -0,0 +1,68 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// tabWidth is the number of spaces a tab is expanded to in side by side output.
+const tabWidth = 4
+
+// SideBySide returns the src declaration (left) and the from declaration
+// (right) of the conflict side by side. Like diff -y does, changed lines are
+// marked with "|", lines only in src with "<" and lines only in the from
+// declaration with ">".
+func (c Conflict) SideBySide() []byte {
+	left, right := sideLines(c.Src), sideLines(c.From)
+	width := len("src")
+	for _, line := range left {
+		if n := utf8.RuneCountInString(line); n > width {
+			width = n
+		}
+	}
+	var out bytes.Buffer
+	row := func(l string, mark byte, r string) {
+		line := fmt.Sprintf("%-*s %c %s", width, l, mark, r)
+		out.WriteString(strings.TrimRight(line, " "))
+		out.WriteByte('\n')
+	}
+	row("src", ' ', "from")
+	ops := editScript(left, right)
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			row(ops[i].line, ' ', ops[i].line)
+			i++
+			continue
+		}
+		// pair the deleted lines of a change with the inserted ones
+		var deleted, inserted []string
+		for ; i < len(ops) && ops[i].kind == '-'; i++ {
+			deleted = append(deleted, ops[i].line)
+		}
+		for ; i < len(ops) && ops[i].kind == '+'; i++ {
+			inserted = append(inserted, ops[i].line)
+		}
+		for k := 0; k < len(deleted) || k < len(inserted); k++ {
+			switch {
+			case k >= len(inserted):
+				row(deleted[k], '<', "")
+			case k >= len(deleted):
+				row("", '>', inserted[k])
+			default:
+				row(deleted[k], '|', inserted[k])
+			}
+		}
+	}
+	return out.Bytes()
+}
+
+// sideLines splits the declaration into lines with expanded tabs.
+func sideLines(decl string) []string {
+	lines := strings.Split(decl, "\n")
+	for i, line := range lines {
+		lines[i] = strings.ReplaceAll(line, "\t", strings.Repeat(" ", tabWidth))
+	}
+	return lines
+}
@@ -0,0 +1,250 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// SubtractSource removes the symbols declared in the src files from the
+// source of a from file and returns the changed source. The src files are
+// given by their name and content, nothing is read from or written to disk.
+func SubtractSource(src map[string][]byte, from []byte) ([]byte, *Result, error) {
+	return (&Arguments{}).SubtractSource(src, from)
+}
+
+// SubtractSource works like the package level SubtractSource, but honors the
+// options set in a. Src, From and the options about writing files are ignored.
+// In Verify mode the src files and the from file are type-checked on their own,
+// so they have to contain all files of their packages.
+func (a *Arguments) SubtractSource(src map[string][]byte, from []byte) ([]byte, *Result, error) {
+	const fromName = "from.go"
+	out, result, err := a.subtractSources(src, map[string][]byte{fromName: from})
+	return out[fromName], result, err
+}
+
+// SubtractFS removes the symbols declared in the src files from the from files
+// of the file system. Src and From are patterns as accepted by fs.Glob. The
+// changed sources of the from files are returned by their path, fsys is not
+// modified.
+// In Verify mode only the matching files are type-checked, so the patterns have
+// to match all files of their packages.
+func (a *Arguments) SubtractFS(fsys fs.FS) (map[string][]byte, *Result, error) {
+	if len(a.Src) == 0 {
+		return nil, nil, NotEnoughSrcFiles
+	}
+	if len(a.From) == 0 {
+		return nil, nil, NotEnoughFromFiles
+	}
+	src, err := readFS(fsys, a.Src)
+	if err != nil {
+		return nil, nil, err
+	}
+	from, err := readFS(fsys, a.From)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a.subtractSources(src, from)
+}
+
+// readFS reads the files matching the patterns.
+func readFS(fsys fs.FS, patterns []string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("could not find file: %s", pattern)
+		}
+		for _, name := range matches {
+			if files[name], err = fs.ReadFile(fsys, name); err != nil {
+				return nil, fmt.Errorf("could not read file: %v", err)
+			}
+		}
+	}
+	return files, nil
+}
+
+// subtractSources runs the diff-sub algorithm on sources in memory and returns
+// the changed from sources. Sources are processed in the order of their names.
+func (a *Arguments) subtractSources(src map[string][]byte, from map[string][]byte) (map[string][]byte, *Result, error) {
+	if len(src) == 0 {
+		return nil, nil, NotEnoughSrcFiles
+	}
+	if len(from) == 0 {
+		return nil, nil, NotEnoughFromFiles
+	}
+	b := *a
+	if b.Stdout == nil {
+		b.Stdout = io.Discard
+	}
+	out := make(map[string][]byte, len(from))
+	result, errs := b.subtract(&job{
+		src:  newSources(src),
+		from: newSources(from),
+		done: func(r *FileResult, original []byte, changed []byte) error {
+			out[r.File] = changed
+			return nil
+		},
+	})
+	if len(result.TypeErrors) > 0 {
+		return nil, result, errs.err()
+	}
+	return out, result, errs.err()
+}
+
+// sources are the contents of Go files by their names.
+type sources struct {
+	names    []string          // the names of the files in the order they are processed
+	contents map[string][]byte // the contents of the files that could be read
+	errs     map[string]error  // why files could not be read
+}
+
+// newSources returns the sources of the files in the order of their names.
+func newSources(files map[string][]byte) *sources {
+	return &sources{names: sortedNames(files), contents: files}
+}
+
+func sortedNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readSources reads the files in the given order.
+func readSources(files []string, read func(string) ([]byte, error)) *sources {
+	s := &sources{names: files, contents: make(map[string][]byte), errs: make(map[string]error)}
+	for _, name := range files {
+		if content, err := read(name); err != nil {
+			s.errs[name] = err
+		} else {
+			s.contents[name] = content
+		}
+	}
+	return s
+}
+
+// file returns the content of a file, the name used in messages is returned as well.
+func (s *sources) file(name string) (string, []byte, error) {
+	fileName := name
+	if name == stdin {
+		fileName = stdinName
+	}
+	content, ok := s.contents[name]
+	if !ok {
+		return fileName, nil, s.errs[name]
+	}
+	return fileName, content, nil
+}
+
+// job describes a run of the diff-sub algorithm on sources in memory.
+type job struct {
+	src     *sources
+	from    *sources
+	context *sources // the other files of the packages, only type-checked in verify mode
+	// done is called with the original and the changed source of each from
+	// file that was processed, an error marks the from file as failed
+	done func(result *FileResult, original []byte, changed []byte) error
+}
+
+// subtract is the core of the diff-sub algorithm used by Run as well as by the
+// in-memory API: it reads the symbols of the src sources and removes them from
+// the from sources. No from file is processed if the src files can't be parsed
+// and KeepGoing is not set. In Verify mode the changed sources are type-checked
+// once all from files were processed.
+func (a *Arguments) subtract(j *job) (*Result, FileErrors) {
+	result := &Result{}
+	errs, ok := a.loadSymbols(j.src, result)
+	if !ok {
+		return result, errs
+	}
+	if a.Verbose {
+		fmt.Fprintf(a.Stdout, "Found symbols:\n")
+		a.printSymbols()
+		fmt.Fprintf(a.Stdout, "Removing duplicate symbols...\n")
+	}
+	result.Symbols = a.sortedSymbols()
+	a.removedNames = make(map[packageKey]*packageNames)
+	for _, name := range j.from.names {
+		if content, ok := j.from.contents[name]; ok {
+			a.addRemovedNames(name, content)
+		}
+	}
+	changed := make(map[string][]byte)
+	var fileErrs FileErrors
+	for _, from := range j.from.names {
+		fr, e := a.subtractFromFile(j, from, changed)
+		result.Files = append(result.Files, fr)
+		dup := len(fr.Removed)
+		if e != nil {
+			fileErrs = append(fileErrs, e)
+			fr.Error = e.Error()
+			if a.Verbose {
+				fmt.Fprintf(a.Stdout, "Error removing symobls from file \"%s\": %v\n", from, e)
+			}
+		} else if a.Verbose && !a.writesFiles() {
+			fmt.Fprintf(a.Stdout, "Would remove %v duplicate symbols from %s\n", dup, from)
+		} else if a.Verbose {
+			fmt.Fprintf(a.Stdout, "Removed %v duplicate symbols from %s\n", dup, from)
+		}
+		if a.Verbose && len(fr.Attached) > 0 {
+			fmt.Fprintf(a.Stdout, "Kept the methods %s of types removed from %s, they now belong to the src types\n", strings.Join(fr.Attached, ", "), from)
+		}
+		if a.Verbose && len(fr.Qualified) > 0 {
+			fmt.Fprintf(a.Stdout, "Qualified the references to %s with package %s in %s\n", strings.Join(fr.Qualified, ", "), a.srcPackage, from)
+		}
+	}
+	if a.Verify && len(fileErrs) == 0 {
+		var context map[string][]byte
+		if j.context != nil {
+			context = j.context.contents
+		}
+		for _, e := range verify(j.src.contents, context, changed) {
+			result.TypeErrors = append(result.TypeErrors, e.Error())
+			fileErrs = append(fileErrs, e)
+		}
+	}
+	return result, append(errs, fileErrs...)
+}
+
+// loadSymbols reads the symbols of the src sources and filters them. It returns
+// the errors of the src files that could not be parsed and whether the from
+// files can be processed.
+func (a *Arguments) loadSymbols(src *sources, result *Result) (FileErrors, bool) {
+	if a.Verbose {
+		fmt.Fprintf(a.Stdout, "Parsing src files...\n")
+	}
+	errs := a.readSymbols(src)
+	for _, e := range errs {
+		result.SrcErrors = append(result.SrcErrors, e.Error())
+	}
+	if len(errs) > 0 && !a.KeepGoing {
+		return errs, false
+	}
+	if err := a.filterSymbols(); err != nil {
+		return FileErrors{err}, false
+	}
+	return errs, true
+}
+
+// subtractFromFile removes the symbols from a single from source and passes
+// the changed source to the done function of the job.
+func (a *Arguments) subtractFromFile(j *job, name string, changed map[string][]byte) (*FileResult, error) {
+	fileName, original, err := j.from.file(name)
+	if err != nil {
+		return &FileResult{File: fileName}, err
+	}
+	result, out, err := a.removeSymbolsFromSource(fileName, original)
+	if err != nil {
+		return result, err
+	}
+	changed[fileName] = out
+	return result, j.done(result, original, out)
+}
@@ -6,27 +6,193 @@ import (
 	"go/ast"
 	"sort"
 	"fmt"
+	"strings"
 )
 
-func (a *Arguments) readSymbols() {
-	a.symbols = make(map[string]struct{})
-	for _, src := range a.Src {
-		a.readSymbolsForFile(src)
+// SymbolKind describes the kind of declaration a symbol originates from.
+type SymbolKind string
+
+// The kinds of declarations that are considered.
+const (
+	FuncSymbol   SymbolKind = "func"
+	MethodSymbol SymbolKind = "method"
+	TypeSymbol   SymbolKind = "type"
+	VarSymbol    SymbolKind = "var"
+	ConstSymbol  SymbolKind = "const"
+)
+
+// allKinds lists the kinds in the order in which symbols are listed.
+var allKinds = []SymbolKind{FuncSymbol, MethodSymbol, TypeSymbol, VarSymbol, ConstSymbol}
+
+// ParseKinds parses a comma separated list of symbol kinds, e.g. "func,type".
+func ParseKinds(list string) ([]SymbolKind, error) {
+	var kinds []SymbolKind
+	for _, k := range strings.Split(list, ",") {
+		kind := SymbolKind(strings.TrimSpace(k))
+		if kindIndex(kind) < 0 {
+			return nil, fmt.Errorf("unknown symbol kind: %s", k)
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+func kindIndex(kind SymbolKind) int {
+	for i, k := range allKinds {
+		if k == kind {
+			return i
+		}
+	}
+	return -1
+}
+
+// keyKind returns the kind of the symbol stored under the qualified key.
+func keyKind(key string) SymbolKind {
+	if i := strings.Index(key, ":"); i >= 0 {
+		return SymbolKind(key[:i])
+	}
+	return MethodSymbol
+}
+
+// removesKind reports whether symbols of the kind are removed,
+// symbols of all kinds are if Kinds is empty.
+func (a *Arguments) removesKind(kind SymbolKind) bool {
+	if len(a.Kinds) == 0 {
+		return true
+	}
+	for _, k := range a.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// isSpecialSymbol reports whether the symbol may be declared many times per
+// package (init functions and blank identifiers) or is the entry point of a
+// program, so that a declaration in src doesn't make it a duplicate.
+func isSpecialSymbol(kind SymbolKind, name string, pkg string) bool {
+	switch {
+	case name == "_":
+		return true
+	case kind == FuncSymbol && name == "init":
+		return true
+	case kind == FuncSymbol && name == "main" && pkg == "main":
+		return true
+	}
+	return false
+}
+
+// requested reports whether a special symbol was explicitly requested
+// by an include pattern naming it literally.
+func (a *Arguments) requested(kind SymbolKind, recv string, name string) bool {
+	for _, p := range a.Include {
+		if p == name || p == symbolKey(kind, recv, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// topLevelKinds share the package scope, so a name declared with any of
+// these kinds in a src file collides with the same name of any other of them.
+var topLevelKinds = []SymbolKind{FuncSymbol, TypeSymbol, VarSymbol, ConstSymbol}
+
+// symbolKey returns the qualified key under which a symbol is stored.
+// Methods are qualified by the base type of their receiver (e.g. "Buffer.Len"),
+// all other symbols by their kind (e.g. "func:Len" or "type:Buffer").
+func symbolKey(kind SymbolKind, recv string, name string) string {
+	if kind == MethodSymbol {
+		return recv + "." + name
+	}
+	return string(kind) + ":" + name
+}
+
+// receiverType returns the name of the base type of a method receiver,
+// regardless of whether the receiver is a pointer or not and of the names
+// of its type parameters (e.g. "List" for "*List[T]").
+func receiverType(recv *ast.FieldList) string {
+	if recv == nil || len(recv.List) == 0 {
+		return ""
+	}
+	expr := recv.List[0].Type
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// topLevelSymbol returns the key of the package level function, type, variable
+// or constant with the given name found in the src files.
+func (a *Arguments) topLevelSymbol(name string) (string, bool) {
+	for _, kind := range topLevelKinds {
+		key := symbolKey(kind, "", name)
+		if _, ok := a.symbols[key]; ok {
+			return key, true
+		}
 	}
+	return "", false
 }
 
-func (a *Arguments) readSymbolsForFile(fileName string) error {
+func (a *Arguments) readSymbols(sources *sources) (errs FileErrors) {
+	a.symbols = make(map[string]string)
+	a.srcPackage = ""
+	for _, src := range sources.names {
+		err := sources.errs[src]
+		if content, ok := sources.contents[src]; ok {
+			err = a.readSymbolsFromSource(src, content)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			if a.Verbose {
+				fmt.Fprintf(a.Stdout, "Error parsing src file \"%s\": %v\n", src, err)
+			}
+		}
+	}
+	return
+}
+
+// readSymbolsFromSource adds the symbols declared in the source of a src file.
+func (a *Arguments) readSymbolsFromSource(fileName string, src []byte) error {
 	fset := token.NewFileSet() // positions are relative to fset
-	f, err := parser.ParseFile(fset, fileName, nil, 0)
+	f, err := parser.ParseFile(fset, fileName, src, 0)
 	if err != nil {
 		return err
 	}
-	ast.Walk(&visitor{a}, f)
+	pkg := f.Name.Name
+	if a.srcPackage == "" {
+		a.srcPackage = pkg
+	} else if !a.crossPackage() && pkg != a.srcPackage {
+		return fmt.Errorf("package %s of src file \"%s\" differs from package %s of the other src files", pkg, fileName, a.srcPackage)
+	}
+	ast.Walk(&visitor{func(kind SymbolKind, recv string, name *ast.Ident, decl string) {
+		if !a.removesKind(kind) {
+			return
+		}
+		if isSpecialSymbol(kind, name.Name, pkg) && !a.requested(kind, recv, name.Name) {
+			return
+		}
+		a.symbols[symbolKey(kind, recv, name.Name)] = decl
+	}}, f)
 	return nil
 }
 
+// visitor calls visit for each name declared at the top level of a file
+// together with its normalized declaration.
 type visitor struct {
-	args *Arguments
+	visit func(kind SymbolKind, recv string, name *ast.Ident, decl string)
 }
 
 func (v *visitor) Visit(node ast.Node) (w ast.Visitor) {
@@ -35,13 +201,17 @@ func (v *visitor) Visit(node ast.Node) (w ast.Visitor) {
 	}
 	switch n := node.(type) {
 	case *ast.FuncDecl:
-		v.visitName(n.Name)
+		if n.Recv != nil {
+			v.visit(MethodSymbol, receiverType(n.Recv), n.Name, normalizeFunc(n))
+		} else {
+			v.visit(FuncSymbol, "", n.Name, normalizeFunc(n))
+		}
 		return nil
 	case *ast.GenDecl:
 		switch n.Tok {
 		case token.CONST, token.TYPE, token.VAR:
-			for _, spec := range n.Specs {
-				v.visitSpecs(spec)
+			for i := range n.Specs {
+				v.visitSpecs(n, i)
 			}
 		}
 		return nil
@@ -49,27 +219,37 @@ func (v *visitor) Visit(node ast.Node) (w ast.Visitor) {
 	return v
 }
 
-func (v *visitor) visitName(name *ast.Ident) {
-	v.args.symbols[name.Name] = struct{}{}
-}
-
-func (v *visitor) visitSpecs(spec ast.Spec) {
-	switch s := spec.(type) {
+func (v *visitor) visitSpecs(d *ast.GenDecl, i int) {
+	switch s := d.Specs[i].(type) {
 	case *ast.ValueSpec:
-		for _, n := range s.Names {
-			v.visitName(n)
+		kind := VarSymbol
+		if d.Tok == token.CONST {
+			kind = ConstSymbol
+		}
+		for j, n := range s.Names {
+			v.visit(kind, "", n, normalizeValue(d, i, j))
 		}
 	case *ast.TypeSpec:
-		v.visitName(s.Name)
+		v.visit(TypeSymbol, "", s.Name, normalizeType(s))
 	}
 }
 
-func (a Arguments) printSymbols() {
+// sortedSymbols returns the qualified keys of the symbols found in src in sorted order.
+func (a Arguments) sortedSymbols() []string {
 	var symbols = make([]string, 0, len(a.symbols))
 	for s := range a.symbols {
 		symbols = append(symbols, s)
 	}
 	sort.Strings(symbols)
+	return symbols
+}
+
+// printSymbols lists the symbols found in src grouped by their kind.
+func (a Arguments) printSymbols() {
+	symbols := a.sortedSymbols()
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return kindIndex(keyKind(symbols[i])) < kindIndex(keyKind(symbols[j]))
+	})
 	for _, s := range symbols {
 		fmt.Fprintf(a.Stdout, "%s\n", s)
 	}
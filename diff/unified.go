@@ -0,0 +1,204 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change.
+const contextLines = 3
+
+// diffOp is a single line of an edit script turning one file into another.
+type diffOp struct {
+	kind byte // ' ' for unchanged, '-' for deleted and '+' for inserted lines
+	line string
+}
+
+// linePair references a line that is equal in both files.
+type linePair struct {
+	x, y int
+}
+
+// unifiedDiff returns the changes between the old and new content of a file
+// in the unified diff format, the same way as gofmt -d does.
+// An empty result is returned if both contents are equal.
+func unifiedDiff(fileName string, old []byte, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "diff %s.orig %s\n", fileName, fileName)
+	fmt.Fprintf(&out, "--- %s.orig\n", fileName)
+	fmt.Fprintf(&out, "+++ %s\n", fileName)
+	writeHunks(&out, editScript(splitLines(old), splitLines(new)))
+	return out.Bytes()
+}
+
+// writeHunks writes the changes of the edit script as hunks with a few lines of context.
+func writeHunks(out *bytes.Buffer, ops []diffOp) {
+	for start := 0; start < len(ops); {
+		// find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		// extend the hunk as long as changes are separated by few unchanged lines
+		end := start
+		for unchanged := 0; end < len(ops) && unchanged <= 2*contextLines; end++ {
+			if ops[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		for end > start && ops[end-1].kind == ' ' {
+			end--
+		}
+		from := start - contextLines
+		if from < 0 {
+			from = 0
+		}
+		to := end + contextLines
+		if to > len(ops) {
+			to = len(ops)
+		}
+		writeHunk(out, ops, from, to)
+		start = to
+	}
+}
+
+// writeHunk writes the lines ops[from:to] as one hunk.
+func writeHunk(out *bytes.Buffer, ops []diffOp, from int, to int) {
+	var oldLine, newLine int
+	for _, op := range ops[:from] {
+		if op.kind != '+' {
+			oldLine++
+		}
+		if op.kind != '-' {
+			newLine++
+		}
+	}
+	var oldCount, newCount int
+	for _, op := range ops[from:to] {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+	if oldCount > 0 {
+		oldLine++
+	}
+	if newCount > 0 {
+		newLine++
+	}
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount)
+	for _, op := range ops[from:to] {
+		out.WriteByte(op.kind)
+		out.WriteString(op.line)
+		if !strings.HasSuffix(op.line, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// splitLines splits the content into lines keeping their line endings.
+func splitLines(content []byte) []string {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// editScript computes the lines to delete from x and insert from y to turn x into y.
+// Lines occurring exactly once in both x and y are used as anchors between which
+// the remaining lines are matched by their common prefix and suffix.
+func editScript(x []string, y []string) []diffOp {
+	var ops []diffOp
+	var i, j int
+	for _, anchor := range append(uniqueMatches(x, y), linePair{len(x), len(y)}) {
+		for i < anchor.x && j < anchor.y && x[i] == y[j] {
+			ops = append(ops, diffOp{' ', x[i]})
+			i, j = i+1, j+1
+		}
+		endX, endY := anchor.x, anchor.y
+		for endX > i && endY > j && x[endX-1] == y[endY-1] {
+			endX, endY = endX-1, endY-1
+		}
+		for ; i < endX; i++ {
+			ops = append(ops, diffOp{'-', x[i]})
+		}
+		for ; j < endY; j++ {
+			ops = append(ops, diffOp{'+', y[j]})
+		}
+		for ; i < anchor.x; i, j = i+1, j+1 {
+			ops = append(ops, diffOp{' ', x[i]})
+		}
+		if anchor.x < len(x) {
+			ops = append(ops, diffOp{' ', x[i]})
+			i, j = i+1, j+1
+		}
+	}
+	return ops
+}
+
+// uniqueMatches returns the longest sequence of lines that occur exactly once
+// in both x and y and appear in the same order in both.
+func uniqueMatches(x []string, y []string) []linePair {
+	type occurrence struct {
+		countX, countY, indexY int
+	}
+	occurrences := make(map[string]*occurrence)
+	get := func(line string) *occurrence {
+		o := occurrences[line]
+		if o == nil {
+			o = &occurrence{}
+			occurrences[line] = o
+		}
+		return o
+	}
+	for _, line := range x {
+		get(line).countX++
+	}
+	for j, line := range y {
+		o := get(line)
+		o.countY++
+		o.indexY = j
+	}
+	var candidates []linePair
+	for i, line := range x {
+		if o := occurrences[line]; o.countX == 1 && o.countY == 1 {
+			candidates = append(candidates, linePair{i, o.indexY})
+		}
+	}
+	// longest increasing subsequence of the y indices (patience sorting)
+	var tails []int
+	prev := make([]int, len(candidates))
+	for k, c := range candidates {
+		n := sort.Search(len(tails), func(t int) bool {
+			return candidates[tails[t]].y >= c.y
+		})
+		prev[k] = -1
+		if n > 0 {
+			prev[k] = tails[n-1]
+		}
+		if n == len(tails) {
+			tails = append(tails, k)
+		} else {
+			tails[n] = k
+		}
+	}
+	matches := make([]linePair, len(tails))
+	if len(tails) > 0 {
+		for i, k := len(tails)-1, tails[len(tails)-1]; i >= 0; i, k = i-1, prev[k] {
+			matches[i] = candidates[k]
+		}
+	}
+	return matches
+}
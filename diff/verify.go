@@ -0,0 +1,83 @@
+package diff
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+)
+
+// verify type-checks the src files together with the changed from files and the
+// unchanged context files and returns the errors found, e.g. references to
+// removed symbols or redeclarations.
+// Files are checked per package clause, so that references to symbols that are
+// only declared in a package other than the one of the from file are reported.
+func verify(src map[string][]byte, context map[string][]byte, from map[string][]byte) (errs FileErrors) {
+	fset := token.NewFileSet()
+	packages := make(map[string][]*ast.File)
+	var names []string
+	add := func(files map[string][]byte) {
+		for _, name := range sortedNames(files) {
+			f, err := parser.ParseFile(fset, name, files[name], 0)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			pkg := f.Name.Name
+			if _, ok := packages[pkg]; !ok {
+				names = append(names, pkg)
+			}
+			packages[pkg] = append(packages[pkg], f)
+		}
+	}
+	add(src)
+	add(context)
+	add(from)
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error: func(err error) {
+			errs = append(errs, err)
+		},
+	}
+	for _, pkg := range names {
+		conf.Check(pkg, fset, packages[pkg], nil)
+	}
+	return
+}
+
+// contextFiles returns the other Go files in the directories of the src and
+// from files. They belong to the same packages, so the changed from files
+// only compile together with them.
+func (a *Arguments) contextFiles() ([]string, error) {
+	given := make(map[string]bool)
+	var dirs []string
+	for _, files := range [][]string{a.srcFiles, a.fromFiles} {
+		for _, file := range files {
+			if file == stdin {
+				continue
+			}
+			given[filepath.Clean(file)] = true
+			dirs = append(dirs, filepath.Dir(file))
+		}
+	}
+	var context []string
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		files, err := goFiles(dir, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if !given[file] {
+				context = append(context, file)
+			}
+		}
+	}
+	return context, nil
+}
@@ -0,0 +1,16 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package diff
+
+import (
+	"syscall"
+)
+
+// accessWrite is W_OK of access(2).
+const accessWrite = 0x2
+
+// writable reports whether the current user may write the file.
+func writable(file string) bool {
+	return syscall.Access(file, accessWrite) == nil
+}
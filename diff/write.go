@@ -0,0 +1,247 @@
+package diff
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pendingWrite is a changed from file that is written once all from files were processed.
+type pendingWrite struct {
+	result   *FileResult
+	original []byte      // the content before the symbols were removed
+	content  []byte      // the content after the symbols were removed
+	target   string      // the file to write, differs from the from file if it is a symbolic link or OutDir is set, "-" for the output
+	mode     os.FileMode // the permissions of the original file
+	owner    os.FileInfo // the original file whose owner is kept, nil if the owner may change
+	temp     string      // the temporary file the content was written to
+}
+
+// writeFile writes the changed content of a from file. In atomic and verify
+// mode the write is postponed until commitWrites is called.
+func (a *Arguments) writeFile(result *FileResult, original []byte, content []byte) error {
+	w := &pendingWrite{result: result, original: original, content: content}
+	prepare := a.prepareWrite
+	if a.OutDir != "" {
+		prepare = a.prepareOutput
+	}
+	if err := prepare(w); err != nil {
+		return err
+	}
+	if a.Atomic || a.Verify {
+		a.pending = append(a.pending, w)
+		return nil
+	}
+	if err := a.writeBackup(w); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(w.target, content, w.mode); err != nil {
+		return fmt.Errorf("writing changed file \"%s\" failed: %v", result.File, err)
+	}
+	result.Written = true
+	return nil
+}
+
+// prepareWrite determines the file to write and checks whether it may be written.
+// Symbolic links are followed unless RefuseSymlinks is set. Read-only files
+// are never written, even if the current user could, e.g. as root, nor are
+// files the current user may not write.
+func (a *Arguments) prepareWrite(w *pendingWrite) error {
+	file := w.result.File
+	info, err := os.Lstat(file)
+	if err != nil {
+		return fmt.Errorf("writing changed file \"%s\" failed: %v", file, err)
+	}
+	w.target = file
+	if info.Mode()&os.ModeSymlink != 0 {
+		if a.RefuseSymlinks {
+			return fmt.Errorf("refusing to write changed file \"%s\": is a symbolic link", file)
+		}
+		if w.target, err = filepath.EvalSymlinks(file); err != nil {
+			return fmt.Errorf("writing changed file \"%s\" failed: %v", file, err)
+		}
+		if info, err = os.Stat(w.target); err != nil {
+			return fmt.Errorf("writing changed file \"%s\" failed: %v", file, err)
+		}
+	}
+	if info.Mode().Perm()&0200 == 0 || !writable(w.target) {
+		return fmt.Errorf("refusing to write changed file \"%s\": is not writable", file)
+	}
+	w.mode, w.owner = info.Mode().Perm(), info
+	return nil
+}
+
+// prepareOutput determines the file in OutDir to write and creates its directory.
+// The path of the from file relative to the working directory is mirrored in OutDir,
+// absolute paths outside of the working directory are mirrored as a whole.
+func (a *Arguments) prepareOutput(w *pendingWrite) error {
+	file := w.result.File
+	info, err := os.Stat(file)
+	if err != nil {
+		return fmt.Errorf("writing file \"%s\" to output directory failed: %v", file, err)
+	}
+	rel := filepath.Clean(file)
+	if wd, err := os.Getwd(); err == nil && filepath.IsAbs(rel) {
+		if r, err := filepath.Rel(wd, rel); err == nil && !isOutside(r) {
+			rel = r
+		}
+	}
+	if filepath.IsAbs(rel) {
+		rel = strings.TrimPrefix(rel, filepath.VolumeName(rel))
+	} else if isOutside(rel) {
+		return fmt.Errorf("cannot mirror file \"%s\" outside of the working directory in the output directory", file)
+	}
+	w.target = filepath.Join(a.OutDir, rel)
+	w.mode = info.Mode().Perm()
+	if err := os.MkdirAll(filepath.Dir(w.target), 0755); err != nil {
+		return fmt.Errorf("writing file \"%s\" to output directory failed: %v", file, err)
+	}
+	w.result.Output = w.target
+	return nil
+}
+
+// isOutside reports whether the relative path leaves its base directory.
+func isOutside(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// writeBackup keeps the original content of the from file if a backup suffix is set.
+func (a *Arguments) writeBackup(w *pendingWrite) error {
+	if a.Backup == "" || a.OutDir != "" {
+		return nil
+	}
+	backup := w.result.File + a.Backup
+	if err := ioutil.WriteFile(backup, w.original, w.mode); err != nil {
+		return fmt.Errorf("writing backup file \"%s\" failed: %v", backup, err)
+	}
+	return nil
+}
+
+// commitWrites writes all postponed changes. The changed contents are written
+// to temporary files first, which are then renamed to the from files.
+// If any step fails all from files are restored to their original content.
+func (a *Arguments) commitWrites() (err error) {
+	pending := a.pending
+	a.pending = nil
+	defer func() {
+		for _, w := range pending {
+			if w.temp != "" {
+				os.Remove(w.temp)
+			}
+		}
+	}()
+	for _, w := range pending {
+		if w.target == stdin {
+			_, err = a.output().Write(w.content)
+			w.result.Written = err == nil
+			return err
+		}
+		if w.temp, err = writeTemp(w.target, w.content, w.mode, w.owner); err != nil {
+			return err
+		}
+	}
+	for _, w := range pending {
+		if err = a.writeBackup(w); err != nil {
+			return err
+		}
+	}
+	for i, w := range pending {
+		if err = os.Rename(w.temp, w.target); err != nil {
+			err = fmt.Errorf("replacing changed file \"%s\" failed: %v", w.result.File, err)
+			a.rollback(pending[:i])
+			return err
+		}
+		w.temp = ""
+		w.result.Written = true
+	}
+	return nil
+}
+
+// rollback restores the original content of the already replaced from files
+// or removes the files already written to OutDir.
+func (a *Arguments) rollback(written []*pendingWrite) {
+	for _, w := range written {
+		if a.OutDir != "" {
+			os.Remove(w.target)
+			w.result.Written = false
+			continue
+		}
+		if err := ioutil.WriteFile(w.target, w.original, w.mode); err != nil {
+			fmt.Fprintf(a.Stdout, "Could not restore file \"%s\": %v\n", w.result.File, err)
+			continue
+		}
+		w.result.Written = false
+		if a.Verbose {
+			fmt.Fprintf(a.Stdout, "Restored original file %s\n", w.result.File)
+		}
+	}
+}
+
+// writeTemp writes the content to a new temporary file next to the given file
+// having the given mode and the same owner as the original file if it is set.
+func writeTemp(file string, content []byte, mode os.FileMode, owner os.FileInfo) (string, error) {
+	dir, name := filepath.Split(file)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := ioutil.TempFile(dir, "."+name+".godiffsub")
+	if err != nil {
+		return "", fmt.Errorf("creating temporary file for \"%s\" failed: %v", file, err)
+	}
+	_, err = tmp.Write(content)
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil && owner != nil {
+		err = chown(tmp.Name(), owner)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("writing temporary file for \"%s\" failed: %v", file, err)
+	}
+	return tmp.Name(), nil
+}
+
+// Undo restores the from files from the backups kept with the Backup suffix
+// and returns the restored files.
+func (a *Arguments) Undo() (restored []string, err error) {
+	if len(a.From) == 0 {
+		return nil, NotEnoughFromFiles
+	}
+	if a.Backup == "" {
+		return nil, NoBackupSuffix
+	}
+	if a.fromFiles, err = expandPatterns(a.From, a.Tests); err != nil {
+		return nil, err
+	}
+	var errs FileErrors
+	for _, from := range a.fromFiles {
+		backup := from + a.Backup
+		original, e := ioutil.ReadFile(backup)
+		if os.IsNotExist(e) {
+			continue
+		}
+		// write the content instead of renaming the backup to keep
+		// the mode and owner of the file as well as symbolic links
+		if e == nil {
+			e = ioutil.WriteFile(from, original, 0644)
+		}
+		if e == nil {
+			e = os.Remove(backup)
+		}
+		if e != nil {
+			errs = append(errs, fmt.Errorf("restoring file \"%s\" failed: %v", from, e))
+			continue
+		}
+		restored = append(restored, from)
+		if a.Verbose {
+			fmt.Fprintf(a.Stdout, "Restored %s from %s\n", from, backup)
+		}
+	}
+	return restored, errs.err()
+}
@@ -11,6 +11,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -41,13 +42,39 @@ var (
 	versionFlag = flag.Bool("v", false, "print the version and exit")
 	verboseFlag = flag.Bool("V", false, "print progress as comments")
 	helpFlag    = flag.Bool("h", false, "print help information")
+	diffFlag    = flag.Bool("d", false, "print the changes as unified diff instead of rewriting the from files")
+	jsonFlag    = flag.Bool("json", false, "print a JSON report of the removed symbols, progress is printed to stderr")
+	keepGoingFlag = flag.Bool("keep-going", false, "process the remaining files if some src files can't be parsed")
+	verifyFlag  = flag.Bool("verify", false, "type-check the src files together with the changed from files and don't write anything if they don't compile")
+	atomicFlag  = flag.Bool("atomic", false, "write the from files only if all of them could be processed, replacing them atomically")
+	backupFlag  = flag.String("backup", "", "keep the original from files with this suffix, e.g. .orig; needed by the undo command")
+	refuseSymlinksFlag = flag.Bool("refuse-symlinks", false, "refuse to write from files that are symbolic links instead of writing to their target")
+	dumpASTFlag = flag.String("dump-ast", "", "debug: append the AST of from files that can't be printed to this file")
+	kindsFlag   = flag.String("kinds", "", "comma separated kinds of symbols to remove: func, method, type, var, const; all kinds if empty")
+	keepFlag    = flag.String("keep", "", "file listing glob patterns of symbols never to remove, one per line, # starts a comment")
+	modeFlag    = flag.String("mode", "name", "remove declarations having the name of a src symbol (name) or only those identical to the src declaration (identical)")
+	conflictErrorFlag = flag.Bool("conflict-error", false, "with -mode=identical, fail instead of warning if declarations differ from src")
+	crossPackageFlag = flag.Bool("cross-package", false, "remove symbols even from files of another package than the src files")
+	srcImportFlag = flag.String("src-import", "", "import path of the src package; remove symbols from files of other packages and qualify the references to them")
+	methodsFlag = flag.String("methods", "keep", "what to do with the methods of removed types: keep them (keep, unless the from file belongs to another package) or remove them as well (cascade)")
+	testsFlag   = flag.Bool("tests", false, "include _test.go files of directories and packages given as -src or -from")
+	dryRunFlag  bool
+	outDirFlag  string
 	srcFlags    inputDataFlags
 	fromFlags   inputDataFlags
+	includeFlags inputDataFlags
+	excludeFlags inputDataFlags
 )
 
 func init() {
-	flag.Var(&srcFlags, "src", "Files whose functions, variables and constants should be considered.")
-	flag.Var(&fromFlags, "from", "Files from which any functions, variables and constants having the same name as the considered ones should be removed.")
+	flag.Var(&srcFlags, "src", "Files, directories, dir/... patterns or packages whose functions, variables and constants should be considered.")
+	flag.Var(&fromFlags, "from", "Files, directories, dir/... patterns, packages or - for standard input (written to standard output) from which any functions, variables and constants having the same name as the considered ones should be removed.")
+	flag.Var(&includeFlags, "include", "Glob pattern of the symbols to remove, matched against the name and the qualified name (e.g. Buffer.Len or func:Len); may be repeated.")
+	flag.Var(&excludeFlags, "exclude", "Glob pattern of the symbols never to remove; may be repeated.")
+	flag.BoolVar(&dryRunFlag, "n", false, "only print the symbols that would be removed, exit with code 2 if there are any")
+	flag.BoolVar(&dryRunFlag, "dry-run", false, "same as -n")
+	flag.StringVar(&outDirFlag, "o", "", "write the from files to this directory, mirroring their paths, instead of rewriting them in place")
+	flag.StringVar(&outDirFlag, "out-dir", "", "same as -o")
 }
 
 func main() {
@@ -60,12 +87,20 @@ func main() {
 func runCommand() int {
 
 	flag.Usage = func() {
-		usage := "Usage: %s [<flags>]\n\n"
+		usage := "Usage: %s [<flags>]\n"
+		usage += "       %s undo -backup <suffix> -from <files>\n"
+		usage += "       %s conflicts -src <files> -from <files>\n\n"
 		usage += "Flags:\n"
-		fmt.Fprintf(stderr, usage, os.Args[0])
+		fmt.Fprintf(stderr, usage, os.Args[0], os.Args[0], os.Args[0])
 		flag.PrintDefaults()
 	}
 	flag.Parse()
+	command := ""
+	if flag.NArg() > 0 {
+		// the flags may also follow the command
+		command = flag.Arg(0)
+		flag.CommandLine.Parse(flag.Args()[1:])
+	}
 
 	if *versionFlag {
 		fmt.Println(program.Version)
@@ -77,19 +112,88 @@ func runCommand() int {
 		return 1
 	}
 
+	var kinds []diff.SymbolKind
+	if *kindsFlag != "" {
+		var err error
+		if kinds, err = diff.ParseKinds(*kindsFlag); err != nil {
+			printUsageError(err)
+			return 1
+		}
+	}
+
+	mode := diff.MatchMode(*modeFlag)
+	if mode != diff.MatchName && mode != diff.MatchIdentical {
+		printUsageError(fmt.Errorf("unknown mode: %s", mode))
+		return 1
+	}
+
+	methods := diff.MethodsMode(*methodsFlag)
+	if methods != diff.KeepMethods && methods != diff.CascadeMethods {
+		printUsageError(fmt.Errorf("unknown methods mode: %s", methods))
+		return 1
+	}
+
 	args := &diff.Arguments{
 		Src:     srcFlags,
 		From:    fromFlags,
+		Kinds:   kinds,
+		Include: includeFlags,
+		Exclude: excludeFlags,
+		Keep:    *keepFlag,
+		Mode:    mode,
+		Methods: methods,
+		CrossPackage: *crossPackageFlag,
+		SrcImport: *srcImportFlag,
+		FailOnConflict: *conflictErrorFlag,
 		Verbose: *verboseFlag,
+		DryRun:  dryRunFlag,
+		PrintDiff: *diffFlag,
+		Tests:   *testsFlag,
+		KeepGoing: *keepGoingFlag,
+		OutDir:  outDirFlag,
+		Atomic:  *atomicFlag,
+		Verify:  *verifyFlag,
+		Backup:  *backupFlag,
+		RefuseSymlinks: *refuseSymlinksFlag,
+		DumpAST: *dumpASTFlag,
 		Stdout:  os.Stdout,
 	}
-	err := args.DiffSub()
-	if err == diff.NotEnoughSrcFiles || err == diff.NotEnoughFromFiles {
-		msg := err.Error()
-		fmt.Fprintf(stderr, "%s%s.\n", strings.ToUpper(msg[0:1]), msg[1:])
+	switch command {
+	case "":
+	case "undo":
+		return runUndo(args)
+	case "conflicts":
+		return runConflicts(args)
+	default:
+		fmt.Fprintf(stderr, "Unknown command: %s\n", command)
 		flag.Usage()
 		return 1
 	}
+	if *jsonFlag {
+		args.Stdout = stderr
+	}
+	for _, from := range fromFlags {
+		if from == "-" {
+			// the changed file is written to stdout, so progress is printed to stderr
+			if *jsonFlag {
+				fmt.Fprintf(stderr, "The JSON report can't be printed when reading from standard input.\n")
+				return 1
+			}
+			args.Stdout = stderr
+			args.Output = os.Stdout
+		}
+	}
+	result, err := args.Run()
+	if *jsonFlag {
+		printReport(result, err)
+	}
+	if err == diff.NotEnoughSrcFiles || err == diff.NotEnoughFromFiles {
+		printUsageError(err)
+		return 1
+	}
+	if err == diff.SymbolsWouldBeRemoved {
+		return 2
+	}
 	if err != nil {
 		fmt.Fprintf(stderr, "Error performing diff-sub operation: %v\n", err)
 		return 1
@@ -97,3 +201,68 @@ func runCommand() int {
 
 	return 0
 }
+
+// runUndo restores the from files from their backups.
+func runUndo(args *diff.Arguments) int {
+	restored, err := args.Undo()
+	if err == diff.NotEnoughFromFiles || err == diff.NoBackupSuffix {
+		printUsageError(err)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error restoring backups: %v\n", err)
+		return 1
+	}
+	if len(restored) == 0 {
+		fmt.Fprintf(stderr, "No backups with suffix %s found.\n", args.Backup)
+		return 1
+	}
+	return 0
+}
+
+// runConflicts lists the declarations of the from files differing from src
+// side by side and returns 2 if there are any.
+func runConflicts(args *diff.Arguments) int {
+	conflicts, err := args.Conflicts()
+	if err == diff.NotEnoughSrcFiles || err == diff.NotEnoughFromFiles {
+		printUsageError(err)
+		return 1
+	}
+	for _, c := range conflicts {
+		fmt.Fprintf(args.Stdout, "%v: %s differs from the src declaration\n", c.Pos, c.Name)
+		args.Stdout.Write(c.SideBySide())
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error comparing declarations: %v\n", err)
+		return 1
+	}
+	if len(conflicts) > 0 {
+		return 2
+	}
+	return 0
+}
+
+func printUsageError(err error) {
+	msg := err.Error()
+	fmt.Fprintf(stderr, "%s%s.\n", strings.ToUpper(msg[0:1]), msg[1:])
+	flag.Usage()
+}
+
+// report is printed with -json
+type report struct {
+	*diff.Result
+	Total int
+	Error string `json:",omitempty"`
+}
+
+func printReport(result *diff.Result, err error) {
+	r := report{Result: result}
+	if result != nil {
+		r.Total = result.Total()
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	out, _ := json.MarshalIndent(r, "", "  ")
+	fmt.Printf("%s\n", out)
+}
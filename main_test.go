@@ -11,6 +11,8 @@ import (
 	"bytes"
 	"github.com/kamphaus/godiffsub/util"
 	"strings"
+	"encoding/json"
+	"fmt"
 )
 
 const testDir = "./tests"
@@ -20,7 +22,13 @@ const testDir = "./tests"
 // Files ending in .src are renamed .go and taken as src argument.
 // Files ending in .from are renamed .go and taken as from argument, after execution
 // of the algorithm they are compared to the file ending in .dst for equality.
+// Subdirectories are copied as well, but their files are not taken as arguments.
 // The stdout output of the algorithm is compared to the content of the out.txt file.
+// An optional args.json file is unmarshalled into the arguments of the algorithm,
+// an optional error.txt file contains the error message the algorithm is expected to return
+// and an optional result.json file contains the expected result marshalled as JSON.
+// The content of an optional stdin.txt file is passed as standard input, the file
+// written to the standard output is compared to the content of the stdout.txt file.
 func TestDiffSub(t *testing.T) {
 	files, err := ioutil.ReadDir(testDir)
 	if err != nil {
@@ -49,16 +57,37 @@ type diffTest struct {
 	tempDir      string
 	testName     string
 	mapFrom2Dest map[string]string
+	mapFrom2Orig map[string]string
 	output       string
+	expectedErr  string
+	result       string
+	stdout       string
 }
 
 func runTest(t *testing.T, test *diffTest) {
-	err := test.DiffSub()
-	if err != nil {
+	result, err := test.Run()
+	if test.result != "" {
+		compareResult(t, test, result)
+	}
+	if outBuf, ok := test.Output.(*bytes.Buffer); ok {
+		if expected := readFile(t, test.stdout); outBuf.String() != expected {
+			t.Error(util.ShowDiff(outBuf.String(), expected))
+		}
+	}
+	if test.expectedErr != "" {
+		errStr := strings.Replace(fmt.Sprint(err), test.tempDir, "tests/"+test.testName, -1)
+		if errStr != test.expectedErr {
+			t.Errorf("expected error %q, got %q", test.expectedErr, errStr)
+		}
+	} else if err != nil {
 		t.Error(err)
 	}
-	for _, from := range test.From {
-		dest := test.mapFrom2Dest[from]
+	for from, dest := range test.mapFrom2Dest {
+		if test.OutDir != "" {
+			// the from files must stay untouched
+			compareFiles(t, from, test.mapFrom2Orig[from])
+			from = filepath.Join(test.OutDir, from)
+		}
 		compareFiles(t, from, dest)
 	}
 	if outBuf, ok := test.Stdout.(*bytes.Buffer); ok && test.output != "" {
@@ -70,11 +99,173 @@ func runTest(t *testing.T, test *diffTest) {
 		outStr := outBuf.String()
 		outStr = strings.Replace(outStr, test.tempDir, "tests/"+test.testName, -1)
 		if outStr != string(out) {
-			t.Errorf(util.ShowDiff(outStr, string(out)))
+			t.Error(util.ShowDiff(outStr, string(out)))
 		}
 	}
 }
 
+// compareResult compares the result marshalled as JSON to the content of the result.json file.
+func compareResult(t *testing.T, test *diffTest, result *diff.Result) {
+	expected, err := ioutil.ReadFile(test.result)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	actual, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	actualStr := strings.Replace(string(actual), test.tempDir, "tests/"+test.testName, -1) + "\n"
+	if actualStr != string(expected) {
+		t.Error(util.ShowDiff(actualStr, string(expected)))
+	}
+}
+
+// TestSubtractSource tests the in-memory API on the files of a test set.
+func TestSubtractSource(t *testing.T) {
+	dir := path.Join(testDir, "set3")
+	src := map[string][]byte{"a.go": []byte(readFile(t, path.Join(dir, "a.src")))}
+	out, result, err := diff.SubtractSource(src, []byte(readFile(t, path.Join(dir, "b.from"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := readFile(t, path.Join(dir, "b.dst")); string(out) != expected {
+		t.Error(util.ShowDiff(string(out), expected))
+	}
+	if result.Total() == 0 {
+		t.Error("expected removed symbols in result")
+	}
+}
+
+// TestSubtractFS tests the in-memory API on a file system.
+func TestSubtractFS(t *testing.T) {
+	dir := path.Join(testDir, "set3")
+	a := &diff.Arguments{Src: []string{"*.src"}, From: []string{"*.from"}}
+	out, _, err := a.SubtractFS(os.DirFS(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := readFile(t, path.Join(dir, "b.dst")); string(out["b.from"]) != expected {
+		t.Error(util.ShowDiff(string(out["b.from"]), expected))
+	}
+	if _, _, err := a.SubtractFS(os.DirFS(path.Join(testDir, "missing"))); err == nil {
+		t.Error("expected error for missing files")
+	}
+}
+
+// TestConflicts tests listing the differing declarations of a test set.
+func TestConflicts(t *testing.T) {
+	src, from := copySet(t, "set21")
+	a := &diff.Arguments{Src: []string{src}, From: []string{from}, Stdout: &bytes.Buffer{}}
+	conflicts, err := a.Conflicts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range conflicts {
+		names = append(names, c.Name)
+	}
+	expected := "func:Abs type:Point const:B const:C var:Min"
+	if actual := strings.Join(names, " "); actual != expected {
+		t.Errorf("expected conflicts %q, got %q", expected, actual)
+	}
+	changed := "func Abs(x int) int {   func Abs(x int) int {\n    if x < 0 {        |     if x <= 0 {\n"
+	if d := string(conflicts[0].SideBySide()); !strings.Contains(d, changed) {
+		t.Errorf("expected declarations side by side containing %q, got %q", changed, d)
+	}
+	compareFiles(t, from, path.Join(testDir, "set21", "b.from"))
+}
+
+// TestNilStdout tests that warnings and debug statements are discarded if no
+// Stdout is given, running the test sets producing them without Stdout.
+func TestNilStdout(t *testing.T) {
+	tests := []struct {
+		set  string
+		args diff.Arguments
+		err  error
+		dst  string
+	}{
+		{"set21", diff.Arguments{Mode: diff.MatchIdentical}, nil, "b.dst"},
+		{"set3", diff.Arguments{DryRun: true}, diff.SymbolsWouldBeRemoved, "b.from"},
+		{"set27", diff.Arguments{SrcImport: "github.com/example/noarch"}, nil, "b.dst"},
+	}
+	for _, test := range tests {
+		t.Run(test.set, func(t *testing.T) {
+			src, from := copySet(t, test.set)
+			a := test.args
+			a.Src, a.From = []string{src}, []string{from}
+			if _, err := a.Run(); err != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			compareFiles(t, from, path.Join(testDir, test.set, test.dst))
+		})
+	}
+}
+
+// TestAtomicKeepsMode tests that atomically replaced files keep their permissions.
+func TestAtomicKeepsMode(t *testing.T) {
+	src, from := copySet(t, "set3")
+	if err := os.Chmod(from, 0755); err != nil {
+		t.Fatal(err)
+	}
+	a := &diff.Arguments{Src: []string{src}, From: []string{from}, Atomic: true}
+	if _, err := a.Run(); err != nil {
+		t.Fatal(err)
+	}
+	compareFiles(t, from, path.Join(testDir, "set3", "b.dst"))
+	if info, err := os.Stat(from); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0755 {
+		t.Errorf("expected mode %v, got %v", os.FileMode(0755), info.Mode().Perm())
+	}
+}
+
+// TestRefuseSymlinks tests that from files that are symbolic links aren't written.
+func TestRefuseSymlinks(t *testing.T) {
+	src, target := copySet(t, "set3")
+	from := filepath.Join(filepath.Dir(target), "link.go")
+	if err := os.Symlink(target, from); err != nil {
+		t.Skip(err)
+	}
+	a := &diff.Arguments{Src: []string{src}, From: []string{from}, RefuseSymlinks: true}
+	_, err := a.Run()
+	expected := fmt.Sprintf("refusing to write changed file \"%s\": is a symbolic link", from)
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+	compareFiles(t, target, path.Join(testDir, "set3", "b.from"))
+}
+
+// TestReadOnly tests that read-only from files are never written, not even as root.
+func TestReadOnly(t *testing.T) {
+	src, from := copySet(t, "set3")
+	if err := os.Chmod(from, 0444); err != nil {
+		t.Fatal(err)
+	}
+	a := &diff.Arguments{Src: []string{src}, From: []string{from}}
+	_, err := a.Run()
+	expected := fmt.Sprintf("refusing to write changed file \"%s\": is not writable", from)
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+	compareFiles(t, from, path.Join(testDir, "set3", "b.from"))
+}
+
+// copySet copies the files a.src and b.from of a test set into a temp
+// directory and returns the names of the copies.
+func copySet(t *testing.T, set string) (src string, from string) {
+	dir := t.TempDir()
+	src, from = filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")
+	if err := copyFileContents(path.Join(testDir, set, "a.src"), src); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyFileContents(path.Join(testDir, set, "b.from"), from); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
 func compareFiles(t *testing.T, a string, b string) {
 	aStr, err := ioutil.ReadFile(a)
 	if err != nil {
@@ -87,7 +278,7 @@ func compareFiles(t *testing.T, a string, b string) {
 		return
 	}
 	if string(aStr) != string(bStr) {
-		t.Errorf(util.ShowDiff(string(aStr), string(bStr)))
+		t.Error(util.ShowDiff(string(aStr), string(bStr)))
 	}
 }
 
@@ -102,35 +293,117 @@ func prepareTest(t *testing.T, testDir string) (a *diffTest) {
 			Stdout: &bytes.Buffer{},
 		},
 		mapFrom2Dest: make(map[string]string),
+		mapFrom2Orig: make(map[string]string),
 		tempDir: dir,
 	}
-	files, err := ioutil.ReadDir(testDir)
-	if err != nil {
-		t.Error(err)
-	}
-	for _, f := range files {
-		dstFile := filepath.Join(dir, f.Name())
+	var argsFile string
+	err = filepath.Walk(testDir, func(file string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(testDir, file)
+		if err != nil {
+			return err
+		}
+		dstFile := filepath.Join(dir, rel)
+		if f.IsDir() {
+			return os.MkdirAll(dstFile, 0755)
+		}
+		// only files at the top level are passed as arguments by default
+		topLevel := filepath.Dir(rel) == "."
 		ext := path.Ext(dstFile)
 		if ext == ".src" {
 			dstFile = dstFile[0:len(dstFile)-len(ext)] + ".go"
-			a.Src = append(a.Src, dstFile)
+			if topLevel {
+				a.Src = append(a.Src, dstFile)
+			}
 		} else if ext == ".from" {
 			resultFile := dstFile[0:len(dstFile)-len(ext)] + ".dst"
 			dstFile = dstFile[0:len(dstFile)-len(ext)] + ".go"
-			a.From = append(a.From, dstFile)
+			if topLevel {
+				a.From = append(a.From, dstFile)
+			}
 			a.mapFrom2Dest[dstFile] = resultFile
+			a.mapFrom2Orig[dstFile] = file
 		}
-		if f.Name() == "out.txt" {
+		if rel == "out.txt" {
 			a.output = dstFile
 		}
-		err := copyFileContents(filepath.Join(testDir, f.Name()), dstFile)
-		if err != nil {
-			t.Error(err)
+		if rel == "stdin.txt" {
+			a.Stdin = strings.NewReader(readFile(t, file))
 		}
+		if rel == "stdout.txt" {
+			a.stdout = dstFile
+			a.Output = &bytes.Buffer{}
+		}
+		if rel == "result.json" {
+			a.result = dstFile
+		}
+		if rel == "args.json" {
+			argsFile = file
+		}
+		if rel == "error.txt" {
+			errStr, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			a.expectedErr = strings.TrimSpace(string(errStr))
+		}
+		return copyFileContents(file, dstFile)
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if argsFile != "" {
+		readArgs(t, argsFile, a)
 	}
 	return
 }
 
+func readFile(t *testing.T, file string) string {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Error(err)
+	}
+	return string(content)
+}
+
+// readArgs sets the arguments specified in the JSON file.
+// Src, From, OutDir and Keep paths are relative to the test directory, if Src and From
+// are given they replace the files found at the top level of the test directory.
+// With OutDir the from files are compared to the .dst files at their mirrored path.
+func readArgs(t *testing.T, file string, test *diffTest) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	src, from := test.Src, test.From
+	test.Src, test.From = nil, nil
+	if err := json.Unmarshal(data, test.Arguments); err != nil {
+		t.Errorf("invalid arguments in %s: %v", file, err)
+	}
+	join := func(files []string, defaults []string) []string {
+		if files == nil {
+			return defaults
+		}
+		for i, f := range files {
+			if f != "-" {
+				files[i] = filepath.Join(test.tempDir, f)
+			}
+		}
+		return files
+	}
+	test.Src = join(test.Src, src)
+	test.From = join(test.From, from)
+	if test.OutDir != "" {
+		test.OutDir = filepath.Join(test.tempDir, test.OutDir)
+	}
+	if test.Keep != "" {
+		test.Keep = filepath.Join(test.tempDir, test.Keep)
+	}
+}
+
 // copyFileContents copies the contents of the file named src to the file named
 // by dst. The file will be created if it does not already exist. If the
 // destination file exists, all it's contents will be replaced by the contents